@@ -0,0 +1,65 @@
+// Package assumerole builds IAM token generators that sign with credentials
+// from an assumed IAM role, covering the common "assume this role, then mint
+// cache tokens" setup in one call.
+//
+// It is a separate package so that the STS client is only linked into
+// programs that use it.
+package assumerole
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/chinmina/iamcacheauth"
+)
+
+// NewElastiCache creates a generator as [iamcacheauth.NewElastiCache] does,
+// signing with credentials from assuming roleARN. See [Credentials].
+func NewElastiCache(ctx context.Context, userID, cacheName, roleARN string, awsCfg aws.Config, opts ...iamcacheauth.Option) (*iamcacheauth.TokenGenerator, error) {
+	if err := withRole(ctx, &awsCfg, roleARN); err != nil {
+		return nil, err
+	}
+	return iamcacheauth.NewElastiCache(userID, cacheName, awsCfg, opts...)
+}
+
+// NewMemoryDB creates a generator as [iamcacheauth.NewMemoryDB] does,
+// signing with credentials from assuming roleARN. See [Credentials].
+func NewMemoryDB(ctx context.Context, userID, clusterName, roleARN string, awsCfg aws.Config, opts ...iamcacheauth.Option) (*iamcacheauth.TokenGenerator, error) {
+	if err := withRole(ctx, &awsCfg, roleARN); err != nil {
+		return nil, err
+	}
+	return iamcacheauth.NewMemoryDB(userID, clusterName, awsCfg, opts...)
+}
+
+// Credentials returns a cached provider of credentials for roleARN, assumed
+// with STS using awsCfg's region and credentials. The role is assumed once
+// with ctx before Credentials returns, so a wrong ARN or a missing
+// sts:AssumeRole permission fails at startup rather than on the first
+// connection; the credentials are then refreshed shortly before they
+// expire.
+//
+// A failure to assume the role matches [iamcacheauth.ErrCredentialRetrieval].
+func Credentials(ctx context.Context, roleARN string, awsCfg aws.Config) (*aws.CredentialsCache, error) {
+	if !arn.IsARN(roleARN) {
+		return nil, fmt.Errorf("assumerole: role ARN %q is not an ARN", roleARN)
+	}
+	provider := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), roleARN))
+	if _, err := provider.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("%w: assuming role %s: %w", iamcacheauth.ErrCredentialRetrieval, roleARN, err)
+	}
+	return provider, nil
+}
+
+// withRole replaces awsCfg's credentials with those from assuming roleARN.
+func withRole(ctx context.Context, awsCfg *aws.Config, roleARN string) error {
+	creds, err := Credentials(ctx, roleARN, *awsCfg)
+	if err != nil {
+		return err
+	}
+	awsCfg.Credentials = creds
+	return nil
+}
@@ -0,0 +1,165 @@
+// Command iamcacheauth prints an IAM authentication token for an
+// ElastiCache cache or MemoryDB cluster, for debugging connections from
+// the shell:
+//
+//	redis-cli --tls -h my-cache.xxxxxx.use1.cache.amazonaws.com \
+//	    --user my-user --pass "$(iamcacheauth --user my-user --name my-cache)"
+//
+// Credentials and, unless --region is given, the region come from the
+// default AWS configuration chain. The token is valid for 15 minutes and
+// must be used only to open connections within that time.
+//
+// With --watch, a fresh token is printed, followed by a blank line, each
+// time the previous one comes within --margin of expiry, until the command
+// is interrupted. Failed refreshes are reported on stderr and retried.
+// Consumers of the stream must still not use a token past its validity:
+// each one replaces the last.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/chinmina/iamcacheauth"
+)
+
+func main() {
+	// Interrupting a watch ends it cleanly rather than killing the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		// The flag set has already printed the error and usage.
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "iamcacheauth:", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage marks flag parse errors, which the flag set reports on stderr
+// itself.
+var errUsage = errors.New("invalid usage")
+
+// options are the parsed command-line flags.
+type options struct {
+	service    string
+	user       string
+	name       string
+	region     string
+	serverless bool
+	watch      bool
+	margin     time.Duration
+}
+
+// parseFlags parses args, writing usage and parse errors to stderr.
+func parseFlags(args []string, stderr io.Writer) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("iamcacheauth", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.service, "service", "elasticache", `service to sign for: "elasticache" or "memorydb"`)
+	fs.StringVar(&opts.user, "user", "", "user ID to authenticate as (required)")
+	fs.StringVar(&opts.name, "name", "", "cache name or MemoryDB cluster name (required)")
+	fs.StringVar(&opts.region, "region", "", "AWS region; defaults to the region from the AWS configuration")
+	fs.BoolVar(&opts.serverless, "serverless", false, "sign for an ElastiCache serverless cache")
+	fs.BoolVar(&opts.watch, "watch", false, "print a fresh token before each expiry until interrupted")
+	fs.DurationVar(&opts.margin, "margin", time.Minute, "with --watch, how long before expiry to print the next token")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return options{}, err
+		}
+		return options{}, fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	switch {
+	case fs.NArg() > 0:
+		return options{}, fmt.Errorf("unexpected arguments: %q", fs.Args())
+	case opts.user == "":
+		return options{}, errors.New("--user is required")
+	case opts.name == "":
+		return options{}, errors.New("--name is required")
+	}
+	return opts, nil
+}
+
+// newGenerator builds the generator named by opts. genOpts are applied
+// after those the flags select.
+func newGenerator(ctx context.Context, opts options, genOpts ...iamcacheauth.Option) (*iamcacheauth.TokenGenerator, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration: %w", err)
+	}
+
+	if opts.region != "" {
+		genOpts = append(genOpts, iamcacheauth.WithRegion(opts.region))
+	}
+	if opts.serverless {
+		genOpts = append(genOpts, iamcacheauth.WithServerless())
+	}
+
+	switch opts.service {
+	case "elasticache":
+		return iamcacheauth.NewElastiCache(opts.user, opts.name, awsCfg, genOpts...)
+	case "memorydb":
+		return iamcacheauth.NewMemoryDB(opts.user, opts.name, awsCfg, genOpts...)
+	default:
+		return nil, fmt.Errorf(`unknown service %q: want "elasticache" or "memorydb"`, opts.service)
+	}
+}
+
+// run prints a token for the flags in args to stdout, or with --watch a
+// stream of them until ctx is done.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	opts, err := parseFlags(args, stderr)
+	if err != nil {
+		return err
+	}
+	if opts.watch {
+		return watch(ctx, opts, stdout, stderr)
+	}
+	gen, err := newGenerator(ctx, opts)
+	if err != nil {
+		return err
+	}
+	token, err := gen.Token(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, token)
+	return err
+}
+
+// watch prints each token from a [iamcacheauth.Refresher] followed by a
+// blank line until ctx is done. The refresher retries failed mints without
+// reporting them, so failures are written to stderr as they happen.
+func watch(ctx context.Context, opts options, stdout, stderr io.Writer) error {
+	gen, err := newGenerator(ctx, opts, iamcacheauth.WithOnError(func(err error) {
+		fmt.Fprintln(stderr, "iamcacheauth:", err)
+	}))
+	if err != nil {
+		return err
+	}
+	r, err := iamcacheauth.NewRefresher(gen, opts.margin)
+	if err != nil {
+		return err
+	}
+	defer r.Stop()
+
+	for token := range r.Start(ctx) {
+		if _, err := fmt.Fprintf(stdout, "%s\n\n", token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
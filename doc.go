@@ -12,7 +12,11 @@
 //	token, err := gen.Token(ctx)
 //
 // Key constraints:
-//   - Every call to Token produces a freshly signed token. Never cache tokens.
+//   - Each call to Token generates a fresh SigV4 presigned token; calls in
+//     the same clock second reuse the signature, which is byte-identical.
+//     Tokens are never cached by default. Wrap the generator with
+//     [NewCaching] to opt in to reusing a token until shortly before it
+//     expires.
 //   - TLS is mandatory for IAM-authenticated connections.
 //   - The server closes IAM-authenticated connections after 12 hours.
 //
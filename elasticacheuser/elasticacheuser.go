@@ -0,0 +1,70 @@
+// Package elasticacheuser checks the ElastiCache user configuration that IAM
+// authentication depends on, so that setup mistakes are reported before a
+// connection attempt fails with an opaque AUTH error.
+//
+// It is a separate package so that the ElastiCache SDK client is only
+// linked into programs that use it.
+package elasticacheuser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+)
+
+// ErrNotIAMUser is returned when the user exists but is not configured with
+// the iam authentication mode.
+var ErrNotIAMUser = errors.New("elasticacheuser: user is not configured for IAM authentication")
+
+// ErrUserNameMismatch is returned when the user's name differs from its ID.
+// ElastiCache requires them to be equal for IAM authentication.
+var ErrUserNameMismatch = errors.New("elasticacheuser: user name must equal user ID for IAM authentication")
+
+// DescribeUsersAPI is the subset of the ElastiCache client used by
+// [VerifyUserAuthMode]. *elasticache.Client satisfies it.
+type DescribeUsersAPI interface {
+	DescribeUsers(ctx context.Context, params *elasticache.DescribeUsersInput, optFns ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error)
+}
+
+// VerifyUserAuthMode looks up userID with DescribeUsers and checks that it
+// is set up for IAM authentication: its authentication type must be iam and
+// its user name must equal its user ID.
+//
+// The caller's principal needs elasticache:DescribeUsers. Errors from the
+// API call, including a missing user, are returned wrapped.
+func VerifyUserAuthMode(ctx context.Context, client DescribeUsersAPI, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("elasticacheuser: userID must not be empty")
+	}
+
+	out, err := client.DescribeUsers(ctx, &elasticache.DescribeUsersInput{
+		UserId: aws.String(userID),
+	})
+	if err != nil {
+		return fmt.Errorf("elasticacheuser: DescribeUsers failed for %q: %w", userID, err)
+	}
+
+	for _, user := range out.Users {
+		if aws.ToString(user.UserId) != userID {
+			continue
+		}
+
+		var authType types.AuthenticationType
+		if user.Authentication != nil {
+			authType = user.Authentication.Type
+		}
+		if authType != types.AuthenticationTypeIam {
+			return fmt.Errorf("%w: %q has authentication type %q", ErrNotIAMUser, userID, authType)
+		}
+		if name := aws.ToString(user.UserName); name != userID {
+			return fmt.Errorf("%w: %q has user name %q", ErrUserNameMismatch, userID, name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("elasticacheuser: user %q not found", userID)
+}
@@ -0,0 +1,79 @@
+package elasticacheuser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+)
+
+// stubClient is a test helper returning a fixed DescribeUsers result.
+type stubClient struct {
+	users []types.User
+	err   error
+}
+
+func (s stubClient) DescribeUsers(_ context.Context, params *elasticache.DescribeUsersInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var users []types.User
+	for _, u := range s.users {
+		if aws.ToString(u.UserId) == aws.ToString(params.UserId) {
+			users = append(users, u)
+		}
+	}
+	return &elasticache.DescribeUsersOutput{Users: users}, nil
+}
+
+func user(id, name string, authType types.AuthenticationType) types.User {
+	return types.User{
+		UserId:         aws.String(id),
+		UserName:       aws.String(name),
+		Authentication: &types.Authentication{Type: authType},
+	}
+}
+
+func TestVerifyUserAuthMode_IAMUser(t *testing.T) {
+	client := stubClient{users: []types.User{user("my-user", "my-user", types.AuthenticationTypeIam)}}
+	if err := VerifyUserAuthMode(context.Background(), client, "my-user"); err != nil {
+		t.Errorf("VerifyUserAuthMode() unexpected error: %v", err)
+	}
+}
+
+func TestVerifyUserAuthMode_PasswordUser(t *testing.T) {
+	client := stubClient{users: []types.User{user("my-user", "my-user", types.AuthenticationTypePassword)}}
+	err := VerifyUserAuthMode(context.Background(), client, "my-user")
+	if !errors.Is(err, ErrNotIAMUser) {
+		t.Errorf("VerifyUserAuthMode() error = %v, want ErrNotIAMUser", err)
+	}
+}
+
+func TestVerifyUserAuthMode_NameMismatch(t *testing.T) {
+	client := stubClient{users: []types.User{user("my-user", "other-name", types.AuthenticationTypeIam)}}
+	err := VerifyUserAuthMode(context.Background(), client, "my-user")
+	if !errors.Is(err, ErrUserNameMismatch) {
+		t.Errorf("VerifyUserAuthMode() error = %v, want ErrUserNameMismatch", err)
+	}
+}
+
+func TestVerifyUserAuthMode_NotFound(t *testing.T) {
+	client := stubClient{}
+	if err := VerifyUserAuthMode(context.Background(), client, "my-user"); err == nil {
+		t.Error("VerifyUserAuthMode() for a missing user should return error")
+	}
+}
+
+func TestVerifyUserAuthMode_APIError(t *testing.T) {
+	sentinel := errors.New("access denied")
+	err := VerifyUserAuthMode(context.Background(), stubClient{err: sentinel}, "my-user")
+	if !errors.Is(err, sentinel) {
+		t.Errorf("VerifyUserAuthMode() error should wrap sentinel, got: %v", err)
+	}
+}
+
+// A real client must satisfy the interface.
+var _ DescribeUsersAPI = (*elasticache.Client)(nil)
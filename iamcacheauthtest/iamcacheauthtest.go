@@ -0,0 +1,93 @@
+// Package iamcacheauthtest provides test doubles for code that depends on
+// [iamcacheauth.Tokener].
+//
+// A [FakeGenerator] returns a token of the test's choosing and can be told
+// to fail, so code that authenticates cache connections can be tested
+// without AWS credentials or network access.
+package iamcacheauthtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/chinmina/iamcacheauth"
+)
+
+// DefaultToken is the token a [FakeGenerator] returns until
+// [FakeGenerator.SetToken] is called.
+const DefaultToken = "iamcacheauth-fake-token"
+
+var _ iamcacheauth.Tokener = (*FakeGenerator)(nil)
+
+// FakeGenerator is an [iamcacheauth.Tokener] that returns a fixed token,
+// or a queued error, without signing anything. It is safe for concurrent
+// use. The zero value returns [DefaultToken].
+type FakeGenerator struct {
+	mu    sync.Mutex
+	token string
+	errs  []error
+	calls int
+}
+
+// NewFakeGenerator creates a [FakeGenerator] that returns token. An empty
+// token means [DefaultToken].
+func NewFakeGenerator(token string) *FakeGenerator {
+	return &FakeGenerator{token: token}
+}
+
+// Token returns the next queued error if there is one, and the configured
+// token otherwise. A done ctx returns its error without consuming the
+// queue. Every call, failed or not, is counted.
+func (f *FakeGenerator) Token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+	if f.token == "" {
+		return DefaultToken, nil
+	}
+	return f.token, nil
+}
+
+// SetToken changes the token returned by later calls. An empty token means
+// [DefaultToken].
+func (f *FakeGenerator) SetToken(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = token
+}
+
+// FailNext queues errs to be returned, one per call, by the next calls to
+// Token. A nil entry lets that call succeed, so a test can interleave
+// failures with successes.
+func (f *FakeGenerator) FailNext(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, errs...)
+}
+
+// Calls reports how many times Token has been called.
+func (f *FakeGenerator) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// CredentialError returns an error that matches
+// [iamcacheauth.ErrCredentialRetrieval] and wraps cause, as a real generator
+// returns when its credential provider fails. Queue it with
+// [FakeGenerator.FailNext] to simulate a credential failure.
+func CredentialError(cause error) error {
+	return fmt.Errorf("%w: %w", iamcacheauth.ErrCredentialRetrieval, cause)
+}
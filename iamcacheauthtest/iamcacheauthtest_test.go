@@ -0,0 +1,80 @@
+package iamcacheauthtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/chinmina/iamcacheauth"
+)
+
+func TestFakeGenerator_Token(t *testing.T) {
+	var zero FakeGenerator
+	if token, err := zero.Token(context.Background()); token != DefaultToken || err != nil {
+		t.Errorf("zero value Token() = %q, %v; want %q", token, err, DefaultToken)
+	}
+
+	f := NewFakeGenerator("token-a")
+	if token, err := f.Token(context.Background()); token != "token-a" || err != nil {
+		t.Errorf("Token() = %q, %v; want %q", token, err, "token-a")
+	}
+	f.SetToken("token-b")
+	if token, err := f.Token(context.Background()); token != "token-b" || err != nil {
+		t.Errorf("Token() after SetToken = %q, %v; want %q", token, err, "token-b")
+	}
+	if f.Calls() != 2 {
+		t.Errorf("Calls() = %d, want 2", f.Calls())
+	}
+}
+
+func TestFakeGenerator_FailNext(t *testing.T) {
+	cause := errors.New("no credentials")
+	boom := errors.New("boom")
+	f := NewFakeGenerator("")
+	f.FailNext(CredentialError(cause), nil, boom)
+
+	_, err := f.Token(context.Background())
+	if !errors.Is(err, iamcacheauth.ErrCredentialRetrieval) || !errors.Is(err, cause) {
+		t.Errorf("first Token() error = %v, want a credential retrieval error wrapping the cause", err)
+	}
+	if token, err := f.Token(context.Background()); token != DefaultToken || err != nil {
+		t.Errorf("second Token() = %q, %v; want success", token, err)
+	}
+	if _, err := f.Token(context.Background()); err != boom {
+		t.Errorf("third Token() error = %v, want %v", err, boom)
+	}
+	if token, err := f.Token(context.Background()); token != DefaultToken || err != nil {
+		t.Errorf("Token() after the queue drains = %q, %v; want success", token, err)
+	}
+}
+
+func TestFakeGenerator_DoneContext(t *testing.T) {
+	f := NewFakeGenerator("")
+	f.FailNext(errors.New("boom"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := f.Token(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Token() error = %v, want context.Canceled", err)
+	}
+	if _, err := f.Token(context.Background()); err == nil {
+		t.Error("a done ctx should not consume the queued error")
+	}
+}
+
+func TestFakeGenerator_Concurrent(t *testing.T) {
+	f := NewFakeGenerator("")
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			if _, err := f.Token(context.Background()); err != nil {
+				t.Errorf("Token() unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	if f.Calls() != 50 {
+		t.Errorf("Calls() = %d, want 50", f.Calls())
+	}
+}
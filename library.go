@@ -1,67 +1,571 @@
 package iamcacheauth
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	smithycreds "github.com/aws/smithy-go/aws-http-auth/credentials"
-	"github.com/aws/smithy-go/aws-http-auth/sigv4"
-	v4 "github.com/aws/smithy-go/aws-http-auth/v4"
 )
 
+// memoryDBServerless reports whether MemoryDB accepts serverless tokens.
+// AWS does not offer serverless MemoryDB, so [NewMemoryDB] and
+// [TokenGenerator.TokenServerless] reject it. Setting this to true is all
+// that enabling it takes in the constructors and TokenServerless; the
+// tests for the enabled path flip it already. ARNs and endpoints that
+// depend on the service must then be checked against what AWS ships.
+var memoryDBServerless = false
+
+// supportsServerless reports whether service accepts
+// ResourceType=ServerlessCache.
+func supportsServerless(service string) bool {
+	return service != "memorydb" || memoryDBServerless
+}
+
 // emptyPayloadHash is the SHA-256 hash of the empty string, precomputed.
 var emptyPayloadHash = sha256.Sum256(nil)
 
-// tokenConfig holds all configuration for token generation.
+// ErrCredentialsExpired is returned when the credential provider hands back
+// credentials that have already expired, typically because a cache in front
+// of the provider failed to refresh. The condition is transient: retrying
+// after the provider refreshes is expected to succeed.
+var ErrCredentialsExpired = errors.New("iamcacheauth: credentials expired")
+
+// maxTokenExpiry is both the default and the longest validity period of a
+// token, signed as X-Amz-Expires. ElastiCache and MemoryDB reject presigned
+// tokens with a longer expiry.
+const maxTokenExpiry = 15 * time.Minute
+
+// Signing failures are classified by cause. Each is returned wrapped with
+// detail, so use [errors.Is] to test for them.
+var (
+	// ErrMalformedRequest is returned when the host, path or query cannot
+	// be assembled into a valid request URL for signing.
+	ErrMalformedRequest = errors.New("iamcacheauth: malformed signing request")
+
+	// ErrInvalidPayloadHash is returned when the payload hash is not a
+	// 32-byte SHA-256 digest.
+	ErrInvalidPayloadHash = errors.New("iamcacheauth: invalid payload hash")
+)
+
+// Construction failures for missing or unsupported configuration can be
+// tested for with [errors.Is]; the messages name the offending field.
+var (
+	ErrEmptyUserID           = errors.New("iamcacheauth: userID must not be empty")
+	ErrEmptyResourceName     = errors.New("iamcacheauth: resource name must not be empty")
+	ErrEmptyRegion           = errors.New("iamcacheauth: region must not be empty")
+	ErrNoCredentialsProvider = errors.New("iamcacheauth: aws.Config must have a Credentials provider")
+	ErrServerlessMemoryDB    = errors.New("iamcacheauth: serverless is not supported for MemoryDB")
+)
+
+// Token failures are classified by whether a retry can help. Credential
+// retrieval commonly fails transiently (IMDS or STS being unavailable) and
+// is worth retrying; a signing failure is a configuration or library bug and
+// is not. Both wrap the underlying cause, which [errors.Unwrap] returns.
+// [ErrCredentialsExpired] is reported separately and is also transient.
+var (
+	ErrCredentialRetrieval = errors.New("iamcacheauth: credential retrieval failed")
+	ErrSigning             = errors.New("iamcacheauth: signing failed")
+)
+
+// classifiedError matches class with [errors.Is] while keeping err, if any,
+// as its direct cause, so a caller can test for the broad class of a
+// failure without losing the original error. msg is the full message.
+type classifiedError struct {
+	class error
+	msg   string
+	err   error
+}
+
+func (e classifiedError) Error() string        { return e.msg }
+func (e classifiedError) Unwrap() error        { return e.err }
+func (e classifiedError) Is(target error) bool { return target == e.class }
+
+// credentialExpiryTolerance allows for clock skew between the credential
+// issuer and this host before credentials are treated as expired.
+const credentialExpiryTolerance = 10 * time.Second
+
+// tokenConfig holds all configuration for token generation. Fields taken
+// from aws.Config are copied individually; the Config itself is never
+// retained, so later changes to a caller's Config cannot reach a generator.
 type tokenConfig struct {
 	userID       string
 	resourceName string // cacheName (ElastiCache) or clusterName (MemoryDB)
 	region       string
-	serverless   bool
-	serviceName  string // "elasticache" or "memorydb"
+	resourceType string        // ResourceType query parameter; empty omits it
+	hostSuffix   string        // appended to resourceName to form the signed host
+	endpoint     string        // replaces resourceName and hostSuffix as the signed host if set
+	path         string        // request path signed into the token; "/" by default
+	expiry       time.Duration // X-Amz-Expires, whole seconds; maxTokenExpiry by default
+	payloadHash  []byte        // SHA-256 of the signed payload; the empty payload by default
+	method       string        // HTTP method signed into the token; GET by default
+	action       string        // Action query parameter; "connect" by default
+	serviceName  string        // "elasticache" or "memorydb"
 	credProvider aws.CredentialsProvider
+
+	omitSecurityToken bool
+	maxTokenLength    int                     // zero means unlimited
+	tokenWrapper      func(raw string) string // nil means the raw token
+
+	captureCtx context.Context // non-nil when credentials are captured at construction
+	baseCtx    context.Context // used by context-free methods; never nil after construction
+
+	envRegionFallback  bool
+	resourceValidator  func(name string) error // nil means no custom rules
+	clock              func() time.Time        // time.Now unless set by WithClock
+	skipUserValidation bool                    // only the empty check applies
+	skipResourceCheck  bool                    // the signed host is not checked as a DNS name
+	logger             *slog.Logger            // nil means no logging
+	fakeSigner         bool                    // see library_fake.go
+
+	// Callbacks set by WithOnTokenGenerated, WithOnError and their
+	// Context variants; nil if unset.
+	onToken    func(service string, expiresAt time.Time)
+	onError    func(err error)
+	onTokenCtx func(ctx context.Context, service string, expiresAt time.Time)
+	onErrorCtx func(ctx context.Context, err error)
+
+	// Options for the credentials cache wrapped around a raw provider.
+	cacheOptions []func(*aws.CredentialsCacheOptions)
+
+	// Credential retrieval retries set by WithRetry. Zero attempts means
+	// one; a nil backoff retries at once.
+	retryAttempts int
+	retryBackoff  func(attempt int) time.Duration
+
+	defaultTimeout time.Duration // bounds retrieval under a deadline-free context; zero means none
 }
 
 // Option configures a [TokenGenerator] using the functional options pattern.
 // The available options are:
 //   - [WithServerless] — marks the target as a serverless cache
+//   - [WithResourceType] — sets or explicitly omits ResourceType
+//   - [WithSecurityToken] — controls emission of X-Amz-Security-Token
+//   - [WithMaxTokenLength] — rejects tokens longer than a limit
+//   - [WithCaptureCredentials] — retrieves credentials once at construction
+//   - [WithCredentials] — signs with fixed credentials instead of a provider
+//   - [WithBaseContext] — context used by context-free methods
+//   - [WithTokenWrapper] — encodes the token before it is returned
+//   - [WithPath] — sets the signed request path
+//   - [WithHTTPMethod] — sets the signed HTTP method
+//   - [WithPayloadHash] — sets the signed payload hash
+//   - [WithAction] — sets the Action query parameter
+//   - [WithRegion] — overrides the region from aws.Config
+//   - [WithEnvRegionFallback] — reads the region from the environment if unset
+//   - [WithResourceValidator] — applies custom rules to the resource name
+//   - [WithHostSuffix] — appends a DNS suffix to the signed host
+//   - [WithExpiry] — sets the token validity period
+//   - [WithClock] — replaces time.Now as the signing clock
+//   - [WithSkipUserValidation] — accepts user IDs outside the usual rules
+//   - [WithSkipResourceValidation] — accepts resource names that are not DNS names
+//   - [WithEndpoint] — signs an explicit host, with optional port, instead of the resource name
+//   - [WithLogger] — logs token generation and failures with log/slog
+//   - [WithOnTokenGenerated] — calls a function for each token returned
+//   - [WithOnError] — calls a function for each failure returned
+//   - [WithOnTokenGeneratedContext] — as WithOnTokenGenerated, with the call's context
+//   - [WithOnErrorContext] — as WithOnError, with the call's context
+//   - [WithCredentialCache] — configures the cache wrapped around a raw provider
+//   - [WithRetry] — retries failed credential retrieval with backoff
+//   - [WithDefaultTimeout] — bounds credential retrieval when the context has no deadline
 type Option func(*tokenConfig) error
 
+// serverlessResourceType is the ResourceType value ElastiCache requires for
+// serverless caches.
+const serverlessResourceType = "ServerlessCache"
+
 // WithServerless marks the target cache as serverless, causing the token to
-// include the ResourceType=ServerlessCache query parameter.
+// include the ResourceType=ServerlessCache query parameter. It is equivalent
+// to WithResourceType("ServerlessCache").
 func WithServerless() Option {
+	return WithResourceType(serverlessResourceType)
+}
+
+// WithResourceType sets the ResourceType query parameter included in the
+// token. The empty string explicitly omits the parameter, which is also the
+// default; this lets tooling that always passes the option signal a
+// replication group. When combined with [WithServerless], the last option
+// applied wins.
+//
+// MemoryDB does not accept a ResourceType; [NewMemoryDB] returns an error
+// for any non-empty value.
+func WithResourceType(resourceType string) Option {
 	return func(cfg *tokenConfig) error {
-		cfg.serverless = true
+		cfg.resourceType = resourceType
 		return nil
 	}
 }
 
+// WithSecurityToken controls whether the X-Amz-Security-Token query parameter
+// is included in the signed token. By default (include is true) the session
+// token is included whenever the retrieved credentials carry one; for
+// long-lived credentials without a session token, including it is a no-op.
+//
+// Passing false suppresses the parameter. Temporary credentials (from STS,
+// IMDS, IRSA and similar) are only valid together with their session token,
+// so the server will reject tokens signed with them when it is suppressed.
+func WithSecurityToken(include bool) Option {
+	return func(cfg *tokenConfig) error {
+		cfg.omitSecurityToken = !include
+		return nil
+	}
+}
+
+// WithMaxTokenLength makes token generation fail when the signed token is
+// longer than n bytes. Some clients limit the length of an AUTH password;
+// this catches pathological user or resource values before the token
+// reaches the client. There is no limit by default.
+func WithMaxTokenLength(n int) Option {
+	return func(cfg *tokenConfig) error {
+		if n <= 0 {
+			return fmt.Errorf("iamcacheauth: max token length must be positive, got %d", n)
+		}
+		cfg.maxTokenLength = n
+		return nil
+	}
+}
+
+// WithCaptureCredentials retrieves credentials once during construction,
+// using ctx, and signs every subsequent token with them. The constructor
+// returns an error if retrieval fails.
+//
+// This suits short-lived tools with static or long-lived credentials. With
+// temporary credentials, tokens start failing once the captured credentials
+// expire, because they are never refreshed.
+func WithCaptureCredentials(ctx context.Context) Option {
+	return func(cfg *tokenConfig) error {
+		if ctx == nil {
+			return fmt.Errorf("iamcacheauth: capture context must not be nil")
+		}
+		cfg.captureCtx = ctx
+		return nil
+	}
+}
+
+// WithCredentials signs every token with creds, in place of the provider
+// in aws.Config, which is then never called and may be nil. It suits
+// callers that already hold resolved credentials, for example from a
+// broker.
+//
+// The caller is responsible for freshness: the credentials are never
+// refreshed, and once they expire Token fails with [ErrCredentialsExpired].
+// Build a new generator to change them.
+func WithCredentials(creds aws.Credentials) Option {
+	return func(cfg *tokenConfig) error {
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return fmt.Errorf("iamcacheauth: credentials must have an access key ID and secret access key")
+		}
+		cfg.credProvider = capturedCredentials{creds: creds}
+		return nil
+	}
+}
+
+// WithBaseContext sets the context used when a token is generated through a
+// method that does not take one, such as [TokenGenerator.CredentialsFunc].
+// Cancelling ctx causes those methods to fail, even once credentials are
+// cached, which lets an application's lifecycle cancellation reach token
+// generation through client callbacks that do not pass a context. The
+// default is [context.Background].
+func WithBaseContext(ctx context.Context) Option {
+	return func(cfg *tokenConfig) error {
+		if ctx == nil {
+			return fmt.Errorf("iamcacheauth: base context must not be nil")
+		}
+		cfg.baseCtx = ctx
+		return nil
+	}
+}
+
+// WithTokenWrapper applies fn to every signed token before it is returned,
+// for transports that expect the credential in an encoded form. The default
+// returns the raw token unchanged. See [Base64Wrapper] for a ready-made
+// wrapper.
+//
+// The wrapper runs before any [WithMaxTokenLength] check, so the limit
+// applies to the string that is actually sent.
+func WithTokenWrapper(fn func(raw string) string) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: token wrapper must not be nil")
+		}
+		cfg.tokenWrapper = fn
+		return nil
+	}
+}
+
+// Base64Wrapper encodes a token with standard, padded base64, for use with
+// [WithTokenWrapper]. The consumer recovers the raw token with
+// base64.StdEncoding.DecodeString.
+func Base64Wrapper(raw string) string {
+	return base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+// WithPath sets the request path used in the canonical request and the
+// signed token. The default, and the only path ElastiCache and MemoryDB
+// accept, is "/"; other values are for services that expect a different
+// path. p must begin with "/".
+func WithPath(p string) Option {
+	return func(cfg *tokenConfig) error {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("iamcacheauth: path %q must begin with \"/\"", p)
+		}
+		cfg.path = p
+		return nil
+	}
+}
+
+// WithHTTPMethod sets the HTTP method used in the canonical request. The
+// default, and the method ElastiCache and MemoryDB expect for connect
+// tokens, is GET. method must be one of the standard methods defined in
+// net/http (e.g. [http.MethodPost]).
+func WithHTTPMethod(method string) Option {
+	return func(cfg *tokenConfig) error {
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete, http.MethodConnect,
+			http.MethodOptions, http.MethodTrace:
+		default:
+			return fmt.Errorf("iamcacheauth: unsupported HTTP method %q", method)
+		}
+		cfg.method = method
+		return nil
+	}
+}
+
+// WithAction sets the Action query parameter signed into the token. The
+// default, and the only action ElastiCache and MemoryDB define, is
+// "connect"; other values are for proxies that expect a different action.
+// action must not be empty.
+func WithAction(action string) Option {
+	return func(cfg *tokenConfig) error {
+		if action == "" {
+			return fmt.Errorf("iamcacheauth: action must not be empty")
+		}
+		cfg.action = action
+		return nil
+	}
+}
+
+// WithPayloadHash sets the SHA-256 hash of the payload used in the
+// canonical request, for unusual signing scenarios such as a proxy that
+// signs a small body. The default, and what ElastiCache and MemoryDB expect
+// for connect tokens, is the hash of the empty payload. hash must be 32
+// bytes and is copied.
+func WithPayloadHash(hash []byte) Option {
+	return func(cfg *tokenConfig) error {
+		if len(hash) != sha256.Size {
+			return fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidPayloadHash, len(hash), sha256.Size)
+		}
+		cfg.payloadHash = bytes.Clone(hash)
+		return nil
+	}
+}
+
+// WithRegion signs tokens for region in place of awsCfg.Region, so
+// generators for caches in several regions can share one aws.Config. The
+// region is validated as at construction.
+func WithRegion(region string) Option {
+	return func(cfg *tokenConfig) error {
+		if err := validateRegion(region); err != nil {
+			return err
+		}
+		cfg.region = region
+		return nil
+	}
+}
+
+// WithEnvRegionFallback makes construction fall back to the AWS_REGION, then
+// AWS_DEFAULT_REGION, environment variables when the region from aws.Config
+// is empty. Without it, an empty region is an error; [config.LoadDefaultConfig]
+// already consults AWS_REGION, so this mainly helps hand-built configs.
+func WithEnvRegionFallback() Option {
+	return func(cfg *tokenConfig) error {
+		cfg.envRegionFallback = true
+		return nil
+	}
+}
+
+// WithResourceValidator adds fn as a custom check of the cache or cluster
+// name, run at construction after the built-in checks. An error from fn is
+// returned from the constructor as is, so callers can match it with
+// [errors.Is] or [errors.As].
+func WithResourceValidator(fn func(name string) error) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: resource validator must not be nil")
+		}
+		cfg.resourceValidator = fn
+		return nil
+	}
+}
+
+// WithHostSuffix appends suffix (e.g. ".internal") to the cache or cluster
+// name to form the host signed into the token, for split-horizon DNS where
+// clients connect to a suffixed name. The name itself, as used for IAM
+// resource ARNs, is unchanged.
+func WithHostSuffix(suffix string) Option {
+	return func(cfg *tokenConfig) error {
+		if suffix == "" {
+			return fmt.Errorf("iamcacheauth: host suffix must not be empty")
+		}
+		cfg.hostSuffix = suffix
+		return nil
+	}
+}
+
+// WithExpiry sets the token validity period, signed as X-Amz-Expires and
+// rounded to whole seconds, for example to align token minting with a
+// pool's refresh cadence. It must lie between one second and 15 minutes,
+// the longest ElastiCache and MemoryDB accept; the default is 15 minutes.
+func WithExpiry(d time.Duration) Option {
+	return func(cfg *tokenConfig) error {
+		d = d.Round(time.Second)
+		if d < time.Second || d > maxTokenExpiry {
+			return fmt.Errorf("iamcacheauth: expiry %v must be between 1s and %v", d, maxTokenExpiry)
+		}
+		cfg.expiry = d
+		return nil
+	}
+}
+
+// WithClock makes the generator read the current time from now instead of
+// time.Now, both for signing and for checking credential expiry, so that
+// downstream tests can assert on X-Amz-Date without a synctest bubble.
+//
+// A clock that does not advance signs every token in the same second, so
+// with unchanged credentials each token is identical to the last.
+// [CachingTokenGenerator], [Refresher] and [Rotator] schedule by the
+// expiry this clock implies, never by comparing tokens, so they keep
+// their usual pace and simply hand out the same token again.
+func WithClock(now func() time.Time) Option {
+	return func(cfg *tokenConfig) error {
+		if now == nil {
+			return fmt.Errorf("iamcacheauth: clock must not be nil")
+		}
+		cfg.clock = now
+		return nil
+	}
+}
+
+// WithSkipUserValidation accepts any non-empty user ID, for access control
+// lists known to allow names outside the rules checked at construction.
+func WithSkipUserValidation() Option {
+	return func(cfg *tokenConfig) error {
+		cfg.skipUserValidation = true
+		return nil
+	}
+}
+
+// WithSkipResourceValidation accepts a cache or cluster name that, with any
+// host suffix, is not a valid DNS name. Custom rules set by
+// [WithResourceValidator] still apply.
+func WithSkipResourceValidation() Option {
+	return func(cfg *tokenConfig) error {
+		cfg.skipResourceCheck = true
+		return nil
+	}
+}
+
+// WithEndpoint signs tokens for host instead of the resource name, for
+// private DNS or test setups where the server expects a different
+// authority. host may include a port and may be a bracketed IPv6 literal,
+// as in "cache.internal:6379" or "[::1]:6379"; tokens begin with it. It
+// cannot be combined with [WithHostSuffix].
+func WithEndpoint(host string) Option {
+	return func(cfg *tokenConfig) error {
+		if err := validateEndpoint(host); err != nil {
+			return err
+		}
+		cfg.endpoint = host
+		return nil
+	}
+}
+
+// WithCredentialCache sets the options of the [aws.CredentialsCache] that
+// construction wraps around a credentials provider, such as its
+// ExpiryWindow. The wrapping itself is the default and needs no option;
+// one cache serves every call on the generator, so concurrent calls share a
+// single retrieval. A provider that is already an [aws.CredentialsCache]
+// is used as is, keeping the options it was built with.
+func WithCredentialCache(optFns ...func(*aws.CredentialsCacheOptions)) Option {
+	return func(cfg *tokenConfig) error {
+		cfg.cacheOptions = append(cfg.cacheOptions, optFns...)
+		return nil
+	}
+}
+
+// capturedCredentials is a provider that always returns the credentials
+// captured by [WithCaptureCredentials] or supplied by [WithCredentials].
+type capturedCredentials struct {
+	creds aws.Credentials
+}
+
+func (c capturedCredentials) Retrieve(context.Context) (aws.Credentials, error) {
+	return c.creds, nil
+}
+
 // TokenGenerator generates IAM authentication tokens for ElastiCache or MemoryDB.
 // It is safe for concurrent use after construction.
 //
 // Use [NewElastiCache] or [NewMemoryDB] to create instances.
 type TokenGenerator struct {
-	cfg tokenConfig
+	cfg    tokenConfig
+	tmpl   *requestTemplate // for the configured signing host; nil if it is invalid
+	last   *signatureCache
+	pieces *queryPiecesCache
+	keys   *signingKeyCache
+
+	// credExpiry is the expiry of the most recently retrieved credentials,
+	// or nil if none were retrieved or they do not expire.
+	credExpiry atomic.Pointer[time.Time]
 }
 
+// Tokener is implemented by types that mint IAM authentication tokens, so
+// callers can depend on it and substitute a fake in tests. Constructors
+// return concrete types; [TokenGenerator], [CachingTokenGenerator] and
+// [FailoverGenerator] all satisfy it.
+type Tokener interface {
+	Token(ctx context.Context) (string, error)
+}
+
+var (
+	_ Tokener = (*TokenGenerator)(nil)
+	_ Tokener = (*CachingTokenGenerator)(nil)
+	_ Tokener = (*FailoverGenerator)(nil)
+)
+
 // NewElastiCache creates a [TokenGenerator] for Amazon ElastiCache.
-// cacheName is the replication group ID or serverless cache name.
+// cacheName is the replication group ID or serverless cache name. It is
+// lowercased once, and that form is used for the token host, the IAM
+// policy ARN and logs.
 //
 // Region is read from awsCfg.Region (set via [config.WithRegion] or resolved
 // from the environment/shared config). Credentials are read from
 // awsCfg.Credentials (the provider chain configured in [aws.Config]).
-// Both are captured at construction time.
+// Both are captured at construction time. A provider that is not already an
+// [aws.CredentialsCache] is wrapped in one, so credentials are reused until
+// they near expiry and concurrent calls share a single retrieval. The cache
+// stops waiting when the context is done, so Token returns on cancellation
+// even if the provider ignores its context; such a provider's Retrieve
+// keeps running in the background, and leaks if it never returns.
 //
 // Use [WithServerless] to target a serverless cache.
 func NewElastiCache(userID, cacheName string, awsCfg aws.Config, opts ...Option) (*TokenGenerator, error) {
 	if cacheName == "" {
-		return nil, fmt.Errorf("iamcacheauth: cacheName must not be empty")
+		return nil, classifiedError{class: ErrEmptyResourceName, msg: "iamcacheauth: cacheName must not be empty"}
 	}
 
 	return newTokenGenerator(tokenConfig{
@@ -74,18 +578,24 @@ func NewElastiCache(userID, cacheName string, awsCfg aws.Config, opts ...Option)
 }
 
 // NewMemoryDB creates a [TokenGenerator] for Amazon MemoryDB.
-// clusterName is the MemoryDB cluster name.
+// clusterName is the MemoryDB cluster name. It is lowercased as for
+// [NewElastiCache].
 //
 // Region is read from awsCfg.Region (set via [config.WithRegion] or resolved
 // from the environment/shared config). Credentials are read from
 // awsCfg.Credentials (the provider chain configured in [aws.Config]).
-// Both are captured at construction time.
+// Both are captured at construction time. A provider that is not already an
+// [aws.CredentialsCache] is wrapped in one, so credentials are reused until
+// they near expiry and concurrent calls share a single retrieval. The cache
+// stops waiting when the context is done, so Token returns on cancellation
+// even if the provider ignores its context; such a provider's Retrieve
+// keeps running in the background, and leaks if it never returns.
 //
-// MemoryDB does not support serverless caches; passing [WithServerless]
-// returns an error.
+// MemoryDB does not support serverless caches; passing [WithServerless], or
+// any non-empty [WithResourceType], returns an error.
 func NewMemoryDB(userID, clusterName string, awsCfg aws.Config, opts ...Option) (*TokenGenerator, error) {
 	if clusterName == "" {
-		return nil, fmt.Errorf("iamcacheauth: clusterName must not be empty")
+		return nil, classifiedError{class: ErrEmptyResourceName, msg: "iamcacheauth: clusterName must not be empty"}
 	}
 
 	gen, err := newTokenGenerator(tokenConfig{
@@ -99,92 +609,906 @@ func NewMemoryDB(userID, clusterName string, awsCfg aws.Config, opts ...Option)
 		return nil, err
 	}
 
-	if gen.cfg.serverless {
-		return nil, fmt.Errorf("iamcacheauth: serverless is not supported for MemoryDB")
+	switch gen.cfg.resourceType {
+	case "":
+	case serverlessResourceType:
+		if !supportsServerless(gen.cfg.serviceName) {
+			return nil, ErrServerlessMemoryDB
+		}
+	default:
+		return nil, fmt.Errorf("iamcacheauth: ResourceType %q is not supported for MemoryDB", gen.cfg.resourceType)
 	}
 
 	return gen, nil
 }
 
-// newTokenGenerator is the shared private constructor. It applies options
-// and validates common fields.
-func newTokenGenerator(cfg tokenConfig, opts []Option) (*TokenGenerator, error) {
+// cachedProvider wraps p in an [aws.CredentialsCache] configured by
+// optFns. config.LoadDefaultConfig already wraps its chain in a cache, but
+// a hand-built aws.Config often holds a raw provider that would otherwise
+// be hit (e.g. an STS call) on every Token. A cache, fixed credentials and
+// nil are returned as they are; fixed credentials gain nothing from a
+// cache.
+func cachedProvider(p aws.CredentialsProvider, optFns ...func(*aws.CredentialsCacheOptions)) aws.CredentialsProvider {
+	switch p.(type) {
+	case nil, *aws.CredentialsCache, capturedCredentials:
+		return p
+	default:
+		return aws.NewCredentialsCache(p, optFns...)
+	}
+}
+
+// applyOptions sets the defaults on cfg, applies opts and resolves the
+// region, without validating the result or touching credentials. The clock
+// is left nil unless [WithClock] sets it.
+func applyOptions(cfg tokenConfig, opts []Option) (tokenConfig, error) {
+	cfg.path = "/"
+	cfg.expiry = maxTokenExpiry
+	cfg.payloadHash = emptyPayloadHash[:]
+	cfg.method = http.MethodGet
+	cfg.action = "connect"
 	for _, opt := range opts {
 		if err := opt(&cfg); err != nil {
-			return nil, err
+			return tokenConfig{}, err
 		}
 	}
 
-	if cfg.userID == "" {
-		return nil, fmt.Errorf("iamcacheauth: userID must not be empty")
+	if cfg.region == "" && cfg.envRegionFallback {
+		cfg.region = os.Getenv("AWS_REGION")
+		if cfg.region == "" {
+			cfg.region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+	}
+	return cfg, nil
+}
+
+// newTokenGenerator is the shared private constructor. It applies options
+// and validates common fields.
+func newTokenGenerator(cfg tokenConfig, opts []Option) (*TokenGenerator, error) {
+	cfg, err := applyOptions(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The server stores resource names in lowercase; lowercasing here
+	// keeps the host, ARN and logs in one form.
+	cfg.resourceName = strings.ToLower(cfg.resourceName)
+	cfg.hostSuffix = strings.ToLower(cfg.hostSuffix)
+	cfg.endpoint = strings.ToLower(cfg.endpoint)
+	if cfg.clock == nil {
+		cfg.clock = time.Now
+	}
+
+	if err := validateUserID(cfg.userID, cfg.skipUserValidation); err != nil {
+		return nil, err
+	}
+	if cfg.baseCtx == nil {
+		cfg.baseCtx = context.Background()
 	}
 	if cfg.region == "" {
-		return nil, fmt.Errorf("iamcacheauth: region must not be empty")
+		return nil, ErrEmptyRegion
+	}
+	if err := validateRegion(cfg.region); err != nil {
+		return nil, err
 	}
 	if cfg.credProvider == nil {
-		return nil, fmt.Errorf("iamcacheauth: aws.Config must have a Credentials provider")
+		return nil, ErrNoCredentialsProvider
+	}
+	if cfg.endpoint != "" && cfg.hostSuffix != "" {
+		return nil, fmt.Errorf("iamcacheauth: WithEndpoint and WithHostSuffix cannot be combined")
+	}
+	if !cfg.skipResourceCheck && cfg.endpoint == "" {
+		if err := validateHostName("resource name", cfg.resourceName+cfg.hostSuffix); err != nil {
+			return nil, err
+		}
 	}
+	if cfg.resourceValidator != nil {
+		if err := cfg.resourceValidator(cfg.resourceName); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.credProvider = cachedProvider(cfg.credProvider, cfg.cacheOptions...)
+
+	if cfg.captureCtx != nil {
+		creds, err := cfg.credProvider.Retrieve(cfg.captureCtx)
+		if err != nil {
+			return nil, fmt.Errorf("iamcacheauth: credential capture failed: %w", err)
+		}
+		cfg.credProvider = capturedCredentials{creds: creds}
+		cfg.captureCtx = nil
+	}
+
+	return newGenerator(cfg), nil
+}
+
+// newGenerator returns a generator for a validated cfg with empty caches.
+// A signing host that does not form a valid request gets no template, so
+// the error is reported when a token is signed, as for hosts given per
+// call.
+func newGenerator(cfg tokenConfig) *TokenGenerator {
+	tmpl, _ := newRequestTemplate(cfg, signingHost(cfg))
+	return &TokenGenerator{
+		cfg:    cfg,
+		tmpl:   tmpl,
+		last:   &signatureCache{},
+		pieces: &queryPiecesCache{},
+		keys:   &signingKeyCache{},
+	}
+}
+
+// LastCredentialExpiry returns when the credentials most recently retrieved
+// for signing expire, so a connection manager can rebuild its aws.Config
+// before session credentials lapse, independent of the token lifetime. It
+// returns the zero time if no credentials have been retrieved yet or the
+// latest ones do not expire.
+func (g *TokenGenerator) LastCredentialExpiry() time.Time {
+	if expires := g.credExpiry.Load(); expires != nil {
+		return *expires
+	}
+	return time.Time{}
+}
+
+// ServiceLabel returns a low-cardinality label identifying the generator's
+// service and region, in the form "service/region" (e.g.
+// "elasticache/us-east-1"). It deliberately omits the user and resource
+// name so it is safe to use as a metric label.
+func (g *TokenGenerator) ServiceLabel() string {
+	return g.cfg.serviceName + "/" + g.cfg.region
+}
+
+// UserID returns the user the generator's tokens authenticate as.
+func (g *TokenGenerator) UserID() string {
+	return g.cfg.userID
+}
+
+// ResourceName returns the cache or cluster name given at construction,
+// lowercased as it is signed.
+func (g *TokenGenerator) ResourceName() string {
+	return g.cfg.resourceName
+}
 
-	return &TokenGenerator{cfg: cfg}, nil
+// Region returns the AWS region tokens are signed for.
+func (g *TokenGenerator) Region() string {
+	return g.cfg.region
+}
+
+// Service returns the SigV4 signing name of the generator's target service:
+// "elasticache" or "memorydb".
+func (g *TokenGenerator) Service() string {
+	return g.cfg.serviceName
+}
+
+// IsServerless reports whether the generator targets a serverless cache,
+// i.e. whether its tokens carry ResourceType=ServerlessCache.
+func (g *TokenGenerator) IsServerless() bool {
+	return g.cfg.resourceType == serverlessResourceType
+}
+
+// maxUserIDLength is the longest user ID accepted at construction.
+const maxUserIDLength = 128
+
+// validateUserID checks that userID is non-empty and, unless skip is set,
+// that it begins with a letter, is at most maxUserIDLength characters and
+// uses only letters, digits and the punctuation "+=,.@_-". A name breaking
+// these rules is otherwise only reported as a failed AUTH at connect time.
+func validateUserID(userID string, skip bool) error {
+	if userID == "" {
+		return ErrEmptyUserID
+	}
+	if skip {
+		return nil
+	}
+	if len(userID) > maxUserIDLength {
+		return fmt.Errorf("iamcacheauth: userID of %d characters exceeds %d", len(userID), maxUserIDLength)
+	}
+	if c := userID[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return fmt.Errorf("iamcacheauth: userID %q must begin with a letter", userID)
+	}
+	for i := 1; i < len(userID); i++ {
+		c := userID[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("+=,.@_-", c) >= 0 {
+			continue
+		}
+		return fmt.Errorf("iamcacheauth: userID %q contains %q; use WithSkipUserValidation if the name is valid", userID, c)
+	}
+	return nil
+}
+
+// maxHostNameLength and maxLabelLength are the DNS limits on a name and on
+// each of its dot-separated labels.
+const (
+	maxHostNameLength = 253
+	maxLabelLength    = 63
+)
+
+// validateHostName checks that host is a DNS name: dot-separated labels of
+// letters, digits and inner hyphens, with at most one trailing dot. The
+// name is signed as the host, so anything else produces a token that fails
+// without saying why. kind names host in errors.
+func validateHostName(kind, host string) error {
+	name := strings.TrimSuffix(host, ".")
+	if len(name) > maxHostNameLength {
+		return fmt.Errorf("iamcacheauth: %s %q exceeds %d characters", kind, host, maxHostNameLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("iamcacheauth: %s %q has an empty DNS label", kind, host)
+		}
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("iamcacheauth: %s %q has a DNS label longer than %d characters", kind, host, maxLabelLength)
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			case c == '-' && i > 0 && i < len(label)-1:
+			default:
+				return fmt.Errorf("iamcacheauth: %s %q is not a valid DNS name", kind, host)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEndpoint checks that host is a DNS name, an IPv4 address or a
+// bracketed IPv6 literal, optionally followed by a port.
+func validateEndpoint(host string) error {
+	if host == "" {
+		return fmt.Errorf("iamcacheauth: endpoint must not be empty")
+	}
+	name, bracketed := host, false
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("iamcacheauth: endpoint %q has an invalid port", host)
+		}
+		name, bracketed = h, strings.HasPrefix(host, "[")
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		name, bracketed = host[1:len(host)-1], true
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		// An unbracketed IPv6 literal is ambiguous with a port.
+		if ip.To4() == nil && !bracketed {
+			return fmt.Errorf("iamcacheauth: IPv6 endpoint %q must be bracketed", host)
+		}
+		return nil
+	}
+	if bracketed {
+		return fmt.Errorf("iamcacheauth: endpoint %q brackets a name that is not an IPv6 address", host)
+	}
+	return validateHostName("endpoint", name)
+}
+
+// maxRegionLength bounds region names well above the longest current AWS
+// region while still catching obviously wrong values.
+const maxRegionLength = 32
+
+// validateRegion performs a syntactic check of an AWS region name: lowercase
+// letters, digits and single hyphens, starting with a letter and not ending
+// in a hyphen. It does not check the region against a list of known regions,
+// so newly launched regions are accepted.
+func validateRegion(region string) error {
+	if region == "" {
+		return ErrEmptyRegion
+	}
+	if len(region) > maxRegionLength {
+		return fmt.Errorf("iamcacheauth: region %q exceeds %d characters", region, maxRegionLength)
+	}
+	for i := 0; i < len(region); i++ {
+		c := region[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == '-' && i > 0 && i < len(region)-1 && region[i-1] != '-':
+		default:
+			return fmt.Errorf("iamcacheauth: region %q is not a valid AWS region name", region)
+		}
+	}
+	// Every region in every partition is named area-location-number, such
+	// as us-east-1, us-gov-west-1 or cn-north-1.
+	parts := strings.Split(region, "-")
+	if len(parts) < 3 || !allDigits(parts[len(parts)-1]) {
+		return fmt.Errorf("iamcacheauth: region %q is not of the form area-location-number", region)
+	}
+	return nil
+}
+
+// partitionPrefixes maps region name prefixes to the partitions outside
+// the standard "aws" partition. Longer prefixes come first so that, for
+// example, us-isob- is not taken for us-iso-.
+var partitionPrefixes = []struct{ prefix, partition string }{
+	{"us-gov-", "aws-us-gov"},
+	{"cn-", "aws-cn"},
+	{"us-isob-", "aws-iso-b"},
+	{"us-isof-", "aws-iso-f"},
+	{"us-iso-", "aws-iso"},
+	{"eu-isoe-", "aws-iso-e"},
+}
+
+// partition returns the AWS partition of region, as used in ARNs. Regions
+// outside the known non-standard prefixes belong to "aws". Signing does
+// not depend on the partition; the credential scope uses the region alone.
+func partition(region string) string {
+	for _, p := range partitionPrefixes {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return "aws"
+}
+
+// allDigits reports whether s is non-empty and consists of ASCII digits.
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // Token generates a fresh IAM authentication token. Each call produces a
-// newly signed token using the current wall-clock time.
+// newly signed token using the current wall-clock time. Calls within the
+// same clock second with unchanged credentials reuse the previous
+// signature, which is byte-identical to signing again.
 //
 // The ctx parameter controls the timeout and deadline for credential
-// retrieval (e.g. from STS, IMDS, or other credential sources). Use
+// retrieval (e.g. from STS, IMDS, or other credential sources); a ctx that
+// is already done fails even when credentials are cached. Use
 // [context.WithTimeout] to bound credential retrieval time. Signing itself
 // is a local CPU-only operation and completes immediately after credentials
 // are obtained.
 //
-// The returned token is valid for 15 minutes but should not be cached;
-// generate a fresh token for each connection attempt.
+// The returned token is valid for 15 minutes, or as set by [WithExpiry],
+// but should not be cached; generate a fresh token for each connection
+// attempt.
 func (g *TokenGenerator) Token(ctx context.Context) (string, error) {
-	awsCreds, err := g.cfg.credProvider.Retrieve(ctx)
+	token, _, err := g.TokenWithExpiry(ctx)
+	return token, err
+}
+
+// TokenWithExpiry generates a fresh token like [TokenGenerator.Token] and
+// returns it with the time, in UTC, at which it stops being valid: the
+// signing time plus the signed X-Amz-Expires. Both come from the same clock
+// reading, for callers that schedule their own refresh.
+func (g *TokenGenerator) TokenWithExpiry(ctx context.Context) (string, time.Time, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := g.cfg.clock()
+	in := g.input(creds, g.signingHost())
+	token, err := g.sign(ctx, in, now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, g.info(in, now).Expires, nil
+}
+
+// TokenAt generates a token like [TokenGenerator.Token], but signed at the
+// supplied instant instead of the current time. This suits callers with
+// their own corrected time source and replay or verification tooling. The
+// instant is converted to UTC; tokens signed at the same second with the
+// same credentials are identical.
+//
+// The token's validity is relative to at, so a past instant yields a token
+// that may already have expired.
+func (g *TokenGenerator) TokenAt(ctx context.Context, at time.Time) (string, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return g.sign(ctx, g.input(creds, g.signingHost()), at)
+}
+
+// Credentials returns the configured user and a fresh token, the pair a
+// client passes to AUTH as username and password. Taking both from the
+// generator keeps the token paired with the user it was signed for.
+func (g *TokenGenerator) Credentials(ctx context.Context) (username, password string, err error) {
+	token, err := g.Token(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return g.cfg.userID, token, nil
+}
+
+// CredentialsFunc returns a context-free function yielding the configured
+// user and a fresh token, suitable for client callbacks that do not receive
+// a context (for example valkey-go's AuthCredentialsFn). Credentials are
+// retrieved using the context set by [WithBaseContext].
+func (g *TokenGenerator) CredentialsFunc() func() (username, password string, err error) {
+	return func() (string, string, error) {
+		return g.Credentials(g.cfg.baseCtx)
+	}
+}
+
+// ConnectCredentialsFunc returns [TokenGenerator.Credentials] as a function
+// value, for per-connection credential hooks such as those of
+// database/sql-style drivers. Drivers with other hook shapes can wrap it.
+// The function is safe for concurrent use.
+func (g *TokenGenerator) ConnectCredentialsFunc() func(ctx context.Context) (username, password string, err error) {
+	return g.Credentials
+}
+
+// TokenWithService generates a fresh token like [TokenGenerator.Token], but
+// signed with service as the SigV4 signing name in place of the generator's
+// own ("elasticache" or "memorydb"). All other parameters are unchanged.
+//
+// This is intended for experimentation, for example when AWS introduces a
+// new signing name ahead of a library release.
+func (g *TokenGenerator) TokenWithService(ctx context.Context, service string) (string, error) {
+	if service == "" {
+		return "", fmt.Errorf("iamcacheauth: service must not be empty")
+	}
+
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	in := g.input(creds, g.signingHost())
+	in.service = service
+	return g.sign(ctx, in, g.cfg.clock())
+}
+
+// WithUser returns a generator identical to g except that its tokens
+// authenticate as userID, validated as the constructor validates the
+// configured user. The two share g's credentials cache; g is unchanged.
+func (g *TokenGenerator) WithUser(userID string) (*TokenGenerator, error) {
+	if err := validateUserID(userID, g.cfg.skipUserValidation); err != nil {
+		return nil, err
+	}
+	cfg := g.cfg
+	cfg.userID = userID
+	return newGenerator(cfg), nil
+}
+
+// TokenForUser generates a fresh token for userID in place of the user
+// configured at construction, keeping the generator's resource, region and
+// service, for minting tokens for several ACL users of one cache. userID is
+// validated as the constructor validates the configured user.
+func (g *TokenGenerator) TokenForUser(ctx context.Context, userID string) (string, error) {
+	if err := validateUserID(userID, g.cfg.skipUserValidation); err != nil {
+		return "", err
+	}
+
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	in := g.input(creds, g.signingHost())
+	in.user = userID
+	return g.sign(ctx, in, g.cfg.clock())
+}
+
+// TokenServerless generates a fresh token for host, including
+// ResourceType=ServerlessCache if serverless is true and omitting any
+// ResourceType otherwise, so one generator can serve a fleet that mixes
+// serverless caches and replication groups under the same user. host is
+// lowercased and used in place of the resource name configured at
+// construction.
+//
+// MemoryDB has no serverless caches, so serverless is rejected for a
+// MemoryDB generator.
+func (g *TokenGenerator) TokenServerless(ctx context.Context, serverless bool, host string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("iamcacheauth: host must not be empty")
+	}
+	if serverless && !supportsServerless(g.cfg.serviceName) {
+		return "", ErrServerlessMemoryDB
+	}
+
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	in := g.input(creds, host)
+	in.resourceType = ""
+	if serverless {
+		in.resourceType = serverlessResourceType
+	}
+	return g.sign(ctx, in, g.cfg.clock())
+}
+
+// TokensForEndpoints generates a pair of tokens for a primary and a reader
+// host using a single credential retrieval. Both tokens share the same
+// signing time, so they expire together.
+//
+// Each host is lowercased and used as the host of its token, in place of
+// the resource name configured at construction.
+func (g *TokenGenerator) TokensForEndpoints(ctx context.Context, primaryHost, readerHost string) (primary, reader string, err error) {
+	if primaryHost == "" {
+		return "", "", fmt.Errorf("iamcacheauth: primaryHost must not be empty")
+	}
+	if readerHost == "" {
+		return "", "", fmt.Errorf("iamcacheauth: readerHost must not be empty")
+	}
+
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := g.cfg.clock()
+	primary, err = g.sign(ctx, g.input(creds, primaryHost), now)
+	if err != nil {
+		return "", "", err
+	}
+	reader, err = g.sign(ctx, g.input(creds, readerHost), now)
 	if err != nil {
-		return "", fmt.Errorf("iamcacheauth: credential retrieval failed: %w", err)
+		return "", "", err
+	}
+
+	return primary, reader, nil
+}
+
+// TokensForRegions generates one token per region using a single credential
+// retrieval, for pre-minting tokens for the primary and standby regions of
+// an active-passive deployment. Tokens share the user and resource name and
+// differ only in their credential scope; the result maps each region to its
+// token.
+//
+// The library cannot know whether the resource exists in each region; it
+// signs regardless, and a missing resource shows up when connecting.
+func (g *TokenGenerator) TokensForRegions(ctx context.Context, regions []string) (map[string]string, error) {
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("iamcacheauth: regions must not be empty")
+	}
+	for _, region := range regions {
+		if err := validateRegion(region); err != nil {
+			return nil, err
+		}
 	}
 
-	// The smithy-go signer uses its own credential type, not the SDK v2 type.
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := g.cfg.clock()
+	tokens := make(map[string]string, len(regions))
+	for _, region := range regions {
+		in := g.input(creds, g.signingHost())
+		in.region = region
+		token, err := g.sign(ctx, in, now)
+		if err != nil {
+			return nil, err
+		}
+		tokens[region] = token
+	}
+
+	return tokens, nil
+}
+
+// TimedToken is one token of a timed batch, with the time taken to produce
+// it.
+type TimedToken struct {
+	Region   string
+	Token    string
+	Duration time.Duration // credential retrieval plus signing
+}
+
+// TimedTokensForRegions generates one token per region like
+// [TokenGenerator.TokensForRegions], in order, timing each one. Credentials
+// are retrieved for each region, normally from the cache in front of the
+// provider, so a slow refresh shows up against the region that waited for
+// it, and each token is signed at the time it is produced.
+//
+// The batch stops at the first failure, including ctx being done. The
+// tokens completed before it are returned together with the error, so a
+// deadline yields partial results rather than none.
+func (g *TokenGenerator) TimedTokensForRegions(ctx context.Context, regions []string) ([]TimedToken, error) {
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("iamcacheauth: regions must not be empty")
+	}
+	for _, region := range regions {
+		if err := validateRegion(region); err != nil {
+			return nil, err
+		}
+	}
+
+	tokens := make([]TimedToken, 0, len(regions))
+	for _, region := range regions {
+		if err := ctx.Err(); err != nil {
+			return tokens, fmt.Errorf("iamcacheauth: batch stopped before %s: %w", region, err)
+		}
+
+		start := time.Now()
+		creds, err := g.retrieveCredentials(ctx)
+		if err != nil {
+			return tokens, err
+		}
+		in := g.input(creds, g.signingHost())
+		in.region = region
+		token, err := g.sign(ctx, in, g.cfg.clock())
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, TimedToken{Region: region, Token: token, Duration: time.Since(start)})
+	}
+
+	return tokens, nil
+}
+
+// retrieveCredentials fetches credentials from the configured provider and
+// converts them to the type used by the signer.
+func (g *TokenGenerator) retrieveCredentials(ctx context.Context) (smithycreds.Credentials, error) {
+	retrieveCtx, cancel := g.retrievalContext(ctx)
+	awsCreds, attempts, err := g.retrieve(retrieveCtx)
+	cancel()
+	if err != nil {
+		msg := ErrCredentialRetrieval.Error()
+		if attempts > 1 {
+			msg += fmt.Sprintf(" after %d attempts", attempts)
+		}
+		err = classifiedError{
+			class: ErrCredentialRetrieval,
+			msg:   msg + ": " + err.Error(),
+			err:   err,
+		}
+		g.tokenFailed(ctx, "iamcacheauth: credential retrieval failed", err)
+		return smithycreds.Credentials{}, err
+	}
+
+	if awsCreds.CanExpire {
+		expires := awsCreds.Expires.UTC()
+		g.credExpiry.Store(&expires)
+	} else {
+		g.credExpiry.Store(nil)
+	}
+
+	// Signing with expired credentials yields a token the server rejects
+	// with an unhelpful error; fail here where the cause is known.
+	if awsCreds.CanExpire && awsCreds.Expires.Add(credentialExpiryTolerance).Before(g.cfg.clock()) {
+		err := fmt.Errorf("%w at %s", ErrCredentialsExpired, awsCreds.Expires.UTC().Format(time.RFC3339))
+		g.tokenFailed(ctx, "iamcacheauth: credentials expired", err)
+		return smithycreds.Credentials{}, err
+	}
+
+	// Signing uses the smithy-go credential type, not the SDK v2 type.
 	creds := smithycreds.Credentials{
 		AccessKeyID:     awsCreds.AccessKeyID,
 		SecretAccessKey: awsCreds.SecretAccessKey,
 		SessionToken:    awsCreds.SessionToken,
 	}
 
-	// X-Amz-Expires must be set before signing so it is included in the
-	// signed query string.
-	query := url.Values{}
-	query.Set("Action", "connect")
-	query.Set("User", g.cfg.userID)
-	query.Set("X-Amz-Expires", "900")
+	// The signer emits X-Amz-Security-Token whenever a session token is
+	// present, so suppression is done by dropping it here.
+	if g.cfg.omitSecurityToken {
+		creds.SessionToken = ""
+	}
+
+	return creds, nil
+}
+
+// signingInput holds the inputs to a signature that may vary between calls
+// on a single generator. Everything else is fixed by the generator's
+// configuration. It is comparable so that it can key the signature cache.
+type signingInput struct {
+	creds        smithycreds.Credentials
+	user         string
+	host         string
+	service      string
+	region       string
+	resourceType string
+}
+
+// signingHost returns the host signed into the generator's own tokens.
+func (g *TokenGenerator) signingHost() string {
+	return signingHost(g.cfg)
+}
+
+// signingHost is [TokenGenerator.signingHost] for cfg.
+func signingHost(cfg tokenConfig) string {
+	if cfg.endpoint != "" {
+		return cfg.endpoint
+	}
+	return cfg.resourceName + cfg.hostSuffix
+}
+
+// input returns the signing input for host using the generator's
+// configured defaults. The host is lowercased: ElastiCache and MemoryDB
+// store resource names in lowercase, and the token's literal host and the
+// signed host must be the same string the server reconstructs.
+func (g *TokenGenerator) input(creds smithycreds.Credentials, host string) signingInput {
+	return signingInput{
+		creds:        creds,
+		user:         g.cfg.userID,
+		host:         strings.ToLower(host),
+		service:      g.cfg.serviceName,
+		region:       g.cfg.region,
+		resourceType: g.cfg.resourceType,
+	}
+}
+
+// signatureKey identifies a signature by its varying inputs and signing
+// second. X-Amz-Date has one-second resolution, so two calls with equal keys
+// produce byte-identical tokens.
+type signatureKey struct {
+	in     signingInput
+	second int64
+}
+
+// signatureCache holds the most recently signed token, so that bursts of
+// Token calls within the same clock second skip recomputing SigV4.
+type signatureCache struct {
+	mu    sync.Mutex
+	key   signatureKey
+	token string
+}
 
-	// ElastiCache rejects serverless tokens without ResourceType, and
-	// rejects replication-group tokens that include it.
-	if g.cfg.serverless {
-		query.Set("ResourceType", "ServerlessCache")
+// sign produces a token for in, signed at the given time. It reuses the
+// previous token when all signing inputs, including the signing second, are
+// unchanged.
+func (g *TokenGenerator) sign(ctx context.Context, in signingInput, now time.Time) (string, error) {
+	key := signatureKey{in: in, second: now.Unix()}
+
+	if token, ok := g.cachedToken(key); ok {
+		g.tokenGenerated(ctx, in, now)
+		return token, nil
 	}
 
-	reqURL := fmt.Sprintf("http://%s/?%s", g.cfg.resourceName, query.Encode())
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	token, err := g.presign(in, now)
 	if err != nil {
-		return "", fmt.Errorf("iamcacheauth: failed to build signing request: %w", err)
+		return "", g.signingFailed(ctx, err)
 	}
 
-	signer := sigv4.New()
-	if err := signer.SignRequest(&sigv4.SignRequestInput{
-		Request:       req,
-		PayloadHash:   emptyPayloadHash[:],
-		Credentials:   creds,
-		Service:       g.cfg.serviceName,
-		Region:        g.cfg.region,
-		Time:          time.Now(),
-		SignatureType: v4.SignatureTypeQueryString,
-	}); err != nil {
-		return "", fmt.Errorf("iamcacheauth: signing failed: %w", err)
+	g.last.mu.Lock()
+	g.last.key = key
+	g.last.token = token
+	g.last.mu.Unlock()
+
+	g.tokenGenerated(ctx, in, now)
+	return token, nil
+}
+
+// cachedToken returns the previous token if it was signed for key.
+func (g *TokenGenerator) cachedToken(key signatureKey) (string, bool) {
+	g.last.mu.Lock()
+	defer g.last.mu.Unlock()
+	if g.last.token != "" && g.last.key == key {
+		return g.last.token, true
 	}
+	return "", false
+}
+
+// signingFailed classifies and reports a presign error. The presign errors
+// already describe the cause; classifying them leaves the message
+// unchanged.
+func (g *TokenGenerator) signingFailed(ctx context.Context, err error) error {
+	err = classifiedError{class: ErrSigning, msg: err.Error(), err: err}
+	g.tokenFailed(ctx, "iamcacheauth: token signing failed", err)
+	return err
+}
+
+// presign computes a SigV4 presigned token for in, signed at the given time.
+func (g *TokenGenerator) presign(in signingInput, now time.Time) (string, error) {
+	token, _, err := g.presignSteps(in, now, false)
+	return token, err
+}
+
+// presignSteps is presign, also returning the steps of the signature, with
+// the intermediate values if keep is set.
+func (g *TokenGenerator) presignSteps(in signingInput, now time.Time, keep bool) (string, signingSteps, error) {
+	parts, steps, err := g.presignParts(in, now, keep)
+	if err != nil {
+		return "", signingSteps{}, err
+	}
+	token, err := g.finishToken(parts.host + parts.path + "?" + parts.query)
+	if err != nil {
+		return "", signingSteps{}, err
+	}
+	return token, steps, nil
+}
 
-	// The token is the presigned URL without the http:// scheme prefix.
-	token := strings.TrimPrefix(req.URL.String(), "http://")
+// tokenParts are the pieces of a raw token, before any [WithTokenWrapper],
+// kept apart so they can be appended to a buffer without first being
+// joined into a string.
+type tokenParts struct {
+	host, path, query string
+}
+
+// finishToken applies the token wrapper and the length limit to a raw
+// token.
+func (g *TokenGenerator) finishToken(token string) (string, error) {
+	if g.cfg.tokenWrapper != nil {
+		token = g.cfg.tokenWrapper(token)
+	}
+	if err := g.checkTokenLength(len(token)); err != nil {
+		return "", err
+	}
 	return token, nil
 }
+
+// checkTokenLength enforces [WithMaxTokenLength] on a token of n bytes.
+func (g *TokenGenerator) checkTokenLength(n int) error {
+	if g.cfg.maxTokenLength > 0 && n > g.cfg.maxTokenLength {
+		return fmt.Errorf("iamcacheauth: token length %d exceeds maximum %d", n, g.cfg.maxTokenLength)
+	}
+	return nil
+}
+
+// presignParts signs in at now and returns the raw token in parts, keeping
+// the intermediate signing values if keep is set. See library_sigv4.go for
+// what is reused between calls.
+func (g *TokenGenerator) presignParts(in signingInput, now time.Time, keep bool) (tokenParts, signingSteps, error) {
+	// SigV4 timestamps are UTC. Convert here so correctness does not depend
+	// on the signer or on the location of the supplied time.
+	now = now.UTC()
+
+	tmpl := g.tmpl
+	if tmpl == nil || in.host != tmpl.host {
+		var err error
+		if tmpl, err = newRequestTemplate(g.cfg, in.host); err != nil {
+			return tokenParts{}, signingSteps{}, err
+		}
+	}
+
+	// The signer hex-encodes whatever it is given, so a wrong-length hash
+	// would otherwise produce a signature no server can reproduce.
+	if len(g.cfg.payloadHash) != sha256.Size {
+		return tokenParts{}, signingSteps{}, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidPayloadHash, len(g.cfg.payloadHash), sha256.Size)
+	}
+
+	var queryBuf [2048]byte
+	query, sigAt := appendPresignQuery(queryBuf[:0], g.pieces.get(tmpl, in), now)
+	steps := sigv4Steps(g.keys.get(in.creds.SecretAccessKey, now, in.service, in.region),
+		tmpl.canonicalPrefix, query, tmpl.canonicalSuffix, in.service, in.region, now, keep)
+	sig := steps.signature
+	if g.cfg.fakeSigner {
+		sig = fakeSignature
+	}
+
+	// The query is written in its canonical form, so a space in the user
+	// is %20 rather than "+". Both decode to a space as a form, but only
+	// %20 does for a decoder that follows RFC 3986 alone.
+	tokenQuery := string(query[:sigAt]) + "X-Amz-Signature=" + sig + string(query[sigAt-1:])
+	return tokenParts{host: in.host, path: tmpl.escapedPath, query: tokenQuery}, steps, nil
+}
+
+// requestTemplate holds the parts of a presigned request that are fixed for
+// a signing host, so they are built and validated once per generator
+// rather than on every token. It is immutable once built.
+type requestTemplate struct {
+	host    string // signing host the template was built for
+	action  string // escaped Action value
+	expires string // X-Amz-Expires value, in seconds
+
+	escapedPath     string // path as written into the token
+	canonicalPrefix string // canonical request before the query
+	canonicalSuffix string // canonical request after the query
+}
+
+// newRequestTemplate builds the template for signing cfg's requests to
+// host.
+func newRequestTemplate(cfg tokenConfig, host string) (*requestTemplate, error) {
+	// Building the URL from its parts escapes the host, so characters such
+	// as "/" or "?" cannot be reinterpreted as a path or query and silently
+	// change the signed host; parsing rejects them instead.
+	reqURL := &url.URL{Host: host, Path: cfg.path}
+	parsed, err := url.Parse(reqURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedRequest, err)
+	}
+	if parsed.Host != host {
+		return nil, fmt.Errorf("%w: host %q parsed as %q", ErrMalformedRequest, host, parsed.Host)
+	}
+	escapedPath := parsed.EscapedPath()
+	return &requestTemplate{
+		host:    host,
+		action:  queryEscape(cfg.action),
+		expires: strconv.Itoa(int(cfg.expiry / time.Second)),
+
+		escapedPath: escapedPath,
+		// SigV4 escapes the already-escaped path again.
+		canonicalPrefix: canonicalRequestPrefix(cfg.method, uriEncode(escapedPath)),
+		canonicalSuffix: canonicalRequestSuffix(host, cfg.payloadHash),
+	}, nil
+}
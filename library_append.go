@@ -0,0 +1,55 @@
+package iamcacheauth
+
+import (
+	"context"
+	"time"
+)
+
+// AppendToken generates a fresh token like [TokenGenerator.Token] and
+// appends it to dst, returning the extended slice, for hot reconnect paths
+// that reuse a buffer rather than allocate a string per token. On error dst
+// is returned unchanged.
+//
+// A token signed afresh is written straight into dst, so it is not kept for
+// reuse by later calls in the same clock second; one already kept by an
+// earlier call is copied in.
+func (g *TokenGenerator) AppendToken(ctx context.Context, dst []byte) ([]byte, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return dst, err
+	}
+	return g.appendSigned(ctx, dst, g.input(creds, g.signingHost()), g.cfg.clock())
+}
+
+// appendSigned is sign for [TokenGenerator.AppendToken], appending to dst.
+func (g *TokenGenerator) appendSigned(ctx context.Context, dst []byte, in signingInput, now time.Time) ([]byte, error) {
+	if token, ok := g.cachedToken(signatureKey{in: in, second: now.Unix()}); ok {
+		g.tokenGenerated(ctx, in, now)
+		return append(dst, token...), nil
+	}
+
+	parts, _, err := g.presignParts(in, now, false)
+	if err != nil {
+		return dst, g.signingFailed(ctx, err)
+	}
+
+	// A wrapper takes and returns a string, so there is nothing to save.
+	if g.cfg.tokenWrapper != nil {
+		token, err := g.finishToken(parts.host + parts.path + "?" + parts.query)
+		if err != nil {
+			return dst, g.signingFailed(ctx, err)
+		}
+		g.tokenGenerated(ctx, in, now)
+		return append(dst, token...), nil
+	}
+
+	if err := g.checkTokenLength(len(parts.host) + len(parts.path) + 1 + len(parts.query)); err != nil {
+		return dst, g.signingFailed(ctx, err)
+	}
+	dst = append(dst, parts.host...)
+	dst = append(dst, parts.path...)
+	dst = append(dst, '?')
+	dst = append(dst, parts.query...)
+	g.tokenGenerated(ctx, in, now)
+	return dst, nil
+}
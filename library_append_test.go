@@ -0,0 +1,110 @@
+package iamcacheauth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendToken_MatchesToken(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"raw", nil},
+		{"wrapped", []Option{WithTokenWrapper(Base64Wrapper)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := WithClock(func() time.Time { return differentialTime })
+			want, err := newElastiCacheGenerator(t, append(tt.opts, clock)...).Token(context.Background())
+			if err != nil {
+				t.Fatalf("Token() unexpected error: %v", err)
+			}
+
+			// A fresh generator has nothing cached, so the token is
+			// signed straight into the buffer.
+			gen := newElastiCacheGenerator(t, append(tt.opts, clock)...)
+			buf, err := gen.AppendToken(context.Background(), []byte("AUTH "))
+			if err != nil {
+				t.Fatalf("AppendToken() unexpected error: %v", err)
+			}
+			if got := string(buf); got != "AUTH "+want {
+				t.Errorf("AppendToken() = %q, want %q", got, "AUTH "+want)
+			}
+		})
+	}
+}
+
+func TestAppendToken_UsesCachedToken(t *testing.T) {
+	gen := newElastiCacheGenerator(t, WithClock(func() time.Time { return differentialTime }))
+	want, err := gen.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	buf, err := gen.AppendToken(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("AppendToken() unexpected error: %v", err)
+	}
+	if string(buf) != want {
+		t.Errorf("AppendToken() = %q, want the cached %q", buf, want)
+	}
+}
+
+func TestAppendToken_MaxLength(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithMaxTokenLength(10)},
+		{WithMaxTokenLength(10), WithTokenWrapper(func(raw string) string { return base64.StdEncoding.EncodeToString([]byte(raw)) })},
+	} {
+		gen := newElastiCacheGenerator(t, opts...)
+		dst := []byte("AUTH ")
+		buf, err := gen.AppendToken(context.Background(), dst)
+		if !errors.Is(err, ErrSigning) || !strings.Contains(err.Error(), "exceeds maximum 10") {
+			t.Errorf("AppendToken() error = %v, want a token length error", err)
+		}
+		if string(buf) != "AUTH " {
+			t.Errorf("AppendToken() on error = %q, want dst unchanged", buf)
+		}
+	}
+}
+
+// BenchmarkAppendToken compares minting into a reused buffer with minting
+// a string. Each iteration signs a new second, so neither is served from
+// the signature cache.
+func BenchmarkAppendToken(b *testing.B) {
+	gen, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"))
+	if err != nil {
+		b.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	creds, err := gen.retrieveCredentials(context.Background())
+	if err != nil {
+		b.Fatalf("retrieveCredentials() unexpected error: %v", err)
+	}
+	in := gen.input(creds, "my-cache")
+
+	b.Run("string", func(b *testing.B) {
+		now := time.Now()
+		b.ReportAllocs()
+		for b.Loop() {
+			now = now.Add(time.Second)
+			if _, err := gen.sign(context.Background(), in, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		now := time.Now()
+		buf := make([]byte, 0, 1024)
+		b.ReportAllocs()
+		for b.Loop() {
+			now = now.Add(time.Second)
+			var err error
+			if buf, err = gen.appendSigned(context.Background(), buf[:0], in, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
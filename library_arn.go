@@ -0,0 +1,51 @@
+package iamcacheauth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// NewFromARN creates a [TokenGenerator] for the cache or cluster named by
+// resourceARN, taking the service, region and resource name from the ARN.
+// Supported resources are ElastiCache replication groups
+// (replicationgroup:NAME), ElastiCache serverless caches
+// (serverlesscache:NAME, which implies [WithServerless]) and MemoryDB
+// clusters (cluster/NAME).
+//
+// The ARN's region replaces awsCfg.Region, before opts are applied.
+// Credentials still come from awsCfg.
+func NewFromARN(userID, resourceARN string, awsCfg aws.Config, opts ...Option) (*TokenGenerator, error) {
+	parsed, err := arn.Parse(resourceARN)
+	if err != nil {
+		return nil, fmt.Errorf("iamcacheauth: invalid ARN %q: %w", resourceARN, err)
+	}
+	if err := validateRegion(parsed.Region); err != nil {
+		return nil, err
+	}
+	if want := partition(parsed.Region); parsed.Partition != want {
+		return nil, fmt.Errorf("iamcacheauth: ARN partition %q does not match region %s (partition %q)", parsed.Partition, parsed.Region, want)
+	}
+	awsCfg.Region = parsed.Region
+
+	switch parsed.Service {
+	case "elasticache":
+		kind, name, _ := strings.Cut(parsed.Resource, ":")
+		switch kind {
+		case "replicationgroup":
+			return NewElastiCache(userID, name, awsCfg, opts...)
+		case "serverlesscache":
+			return NewElastiCache(userID, name, awsCfg, append([]Option{WithServerless()}, opts...)...)
+		}
+	case "memorydb":
+		kind, name, _ := strings.Cut(parsed.Resource, "/")
+		if kind == "cluster" {
+			return NewMemoryDB(userID, name, awsCfg, opts...)
+		}
+	default:
+		return nil, fmt.Errorf("iamcacheauth: ARN service %q is not supported; want elasticache or memorydb", parsed.Service)
+	}
+	return nil, fmt.Errorf("iamcacheauth: ARN resource %q is not a supported %s resource", parsed.Resource, parsed.Service)
+}
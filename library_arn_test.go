@@ -0,0 +1,72 @@
+package iamcacheauth
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewFromARN(t *testing.T) {
+	tests := []struct {
+		arn        string
+		service    string
+		region     string
+		host       string
+		serverless bool
+	}{
+		{
+			arn:     "arn:aws:elasticache:us-west-2:123456789012:replicationgroup:my-cache",
+			service: "elasticache", region: "us-west-2", host: "my-cache",
+		},
+		{
+			arn:     "arn:aws:elasticache:us-east-1:123456789012:serverlesscache:my-serverless",
+			service: "elasticache", region: "us-east-1", host: "my-serverless", serverless: true,
+		},
+		{
+			arn:     "arn:aws:memorydb:eu-west-1:123456789012:cluster/my-cluster",
+			service: "memorydb", region: "eu-west-1", host: "my-cluster",
+		},
+		{
+			arn:     "arn:aws-us-gov:elasticache:us-gov-west-1:123456789012:replicationgroup:gov-cache",
+			service: "elasticache", region: "us-gov-west-1", host: "gov-cache",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			gen, err := NewFromARN("my-user", tt.arn, testAWSConfig("ap-southeast-2"))
+			if err != nil {
+				t.Fatalf("NewFromARN() unexpected error: %v", err)
+			}
+			if got := gen.ServiceLabel(); got != tt.service+"/"+tt.region {
+				t.Errorf("ServiceLabel() = %q, want %q", got, tt.service+"/"+tt.region)
+			}
+			if gen.IsServerless() != tt.serverless {
+				t.Errorf("IsServerless() = %v, want %v", gen.IsServerless(), tt.serverless)
+			}
+			token, err := gen.Token(context.Background())
+			if err != nil {
+				t.Fatalf("Token() unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(token, tt.host+"/?") {
+				t.Errorf("token should start with %q, got %q", tt.host+"/?", token[:min(len(token), 30)])
+			}
+		})
+	}
+}
+
+func TestNewFromARN_Invalid(t *testing.T) {
+	for _, arn := range []string{
+		"my-cache",
+		"arn:aws:s3:::my-bucket",
+		"arn:aws:elasticache:us-east-1:123456789012:cluster:my-node",
+		"arn:aws:elasticache:us-east-1:123456789012:user:my-user",
+		"arn:aws:memorydb:us-east-1:123456789012:user/my-user",
+		"arn:aws:elasticache:us-east-1:123456789012:replicationgroup:",
+		"arn:aws:elasticache:not a region:123456789012:replicationgroup:my-cache",
+		"arn:aws:elasticache:cn-north-1:123456789012:replicationgroup:my-cache",
+	} {
+		if _, err := NewFromARN("my-user", arn, testAWSConfig("us-east-1")); err == nil {
+			t.Errorf("NewFromARN(%q) should return error", arn)
+		}
+	}
+}
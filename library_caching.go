@@ -0,0 +1,125 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRefreshMargin is how long before expiry a [CachingTokenGenerator]
+// replaces its token when no margin is given.
+const defaultRefreshMargin = 60 * time.Second
+
+// CachingTokenGenerator returns the same token until it is within a refresh
+// margin of expiry, then mints a new one. It trades the default of a fresh
+// token per call for fewer credential retrievals and signatures, for
+// connection code that authenticates far more often than tokens expire.
+//
+// It is safe for concurrent use. While the cached token is usable, Token
+// returns it without locking; when it is due, one caller mints a
+// replacement and concurrent callers wait for it.
+type CachingTokenGenerator struct {
+	gen           *TokenGenerator
+	margin        time.Duration
+	staleFallback bool
+
+	mu     sync.Mutex // held while minting
+	cached atomic.Pointer[cachedToken]
+}
+
+type cachedToken struct {
+	token string
+	info  TokenInfo
+}
+
+// CachingOption configures a [CachingTokenGenerator]. The available
+// options are:
+//   - [WithStaleFallback] — serves the cached token when a refresh's credentials fail
+type CachingOption func(*CachingTokenGenerator)
+
+// WithStaleFallback makes a refresh that fails to retrieve credentials
+// ([ErrCredentialRetrieval] or [ErrCredentialsExpired]) return the cached
+// token instead of the error, for as long as that token has not expired.
+// This favours availability: a momentary STS error does not fail a
+// reconnect while a valid token is at hand. Each fallback is logged at warn
+// level through the wrapped generator's [WithLogger]; the next call tries
+// to refresh again. Once the cached token expires, or on any other error,
+// the error is returned as usual.
+func WithStaleFallback() CachingOption {
+	return func(c *CachingTokenGenerator) {
+		c.staleFallback = true
+	}
+}
+
+// NewCaching wraps gen in a [CachingTokenGenerator] that refreshes margin
+// before expiry. A zero margin means 60 seconds. The margin must be shorter
+// than the token lifetime, or every call would mint a new token.
+func NewCaching(gen *TokenGenerator, margin time.Duration, opts ...CachingOption) (*CachingTokenGenerator, error) {
+	if gen == nil {
+		return nil, fmt.Errorf("iamcacheauth: generator must not be nil")
+	}
+	if margin == 0 {
+		margin = defaultRefreshMargin
+	}
+	if margin < 0 || margin >= gen.cfg.expiry {
+		return nil, fmt.Errorf("iamcacheauth: refresh margin %v must be between 0 and the token expiry %v", margin, gen.cfg.expiry)
+	}
+	c := &CachingTokenGenerator{gen: gen, margin: margin}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Token returns the cached token, or a fresh one from the wrapped
+// generator if the cached token is missing or within the refresh margin of
+// expiry. ctx is used only when a new token is minted.
+func (c *CachingTokenGenerator) Token(ctx context.Context) (string, error) {
+	if token, ok := c.usable(); ok {
+		return token, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another caller may have refreshed while this one waited.
+	if token, ok := c.usable(); ok {
+		return token, nil
+	}
+
+	token, info, err := c.gen.TokenAndInfo(ctx)
+	if err != nil {
+		if token, ok := c.stale(ctx, err); ok {
+			return token, nil
+		}
+		return "", err
+	}
+	c.cached.Store(&cachedToken{token: token, info: info})
+	return token, nil
+}
+
+// usable returns the cached token if it is not yet due for refresh.
+func (c *CachingTokenGenerator) usable() (string, bool) {
+	cached := c.cached.Load()
+	if cached == nil || cached.info.RefreshAfter(c.margin, c.gen.cfg.clock()) <= 0 {
+		return "", false
+	}
+	return cached.token, true
+}
+
+// stale returns the cached token in place of err if [WithStaleFallback] is
+// set, err is a credential failure, ctx is live and the token is unexpired.
+func (c *CachingTokenGenerator) stale(ctx context.Context, err error) (string, bool) {
+	if !c.staleFallback || ctx.Err() != nil || !errors.Is(err, ErrCredentialRetrieval) && !errors.Is(err, ErrCredentialsExpired) {
+		return "", false
+	}
+	cached := c.cached.Load()
+	if cached == nil || !c.gen.cfg.clock().Before(cached.info.Expires) {
+		return "", false
+	}
+	c.gen.staleTokenServed(ctx, cached.info.Expires, err)
+	return cached.token, true
+}
@@ -0,0 +1,44 @@
+package iamcacheauth
+
+import "context"
+
+// SigningDebug holds the intermediate SigV4 values behind a token, for
+// comparing against what the server expects when a token is rejected.
+type SigningDebug struct {
+	CanonicalRequest string
+	StringToSign     string
+	CredentialScope  string
+	SignedHeaders    string
+}
+
+// TokenWithDebug generates a fresh token like [TokenGenerator.Token] and
+// returns the SigV4 steps that produced it, taken from the same signing
+// code rather than recomputed.
+//
+// It is a diagnostic API: it bypasses the per-second signature reuse of
+// Token and keeps every intermediate string, so do not use it on hot
+// paths. The canonical request includes any session token, so treat the
+// debug values with the same care as the token itself.
+func (g *TokenGenerator) TokenWithDebug(ctx context.Context) (string, SigningDebug, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", SigningDebug{}, err
+	}
+
+	now := g.cfg.clock()
+	in := g.input(creds, g.signingHost())
+	token, steps, err := g.presignSteps(in, now, true)
+	if err != nil {
+		err = classifiedError{class: ErrSigning, msg: err.Error(), err: err}
+		g.tokenFailed(ctx, "iamcacheauth: token signing failed", err)
+		return "", SigningDebug{}, err
+	}
+	g.tokenGenerated(ctx, in, now)
+
+	return token, SigningDebug{
+		CanonicalRequest: steps.canonicalRequest,
+		StringToSign:     steps.stringToSign,
+		CredentialScope:  credentialScope(now.UTC(), in.service, in.region),
+		SignedHeaders:    sigv4SignedHeaders,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package iamcacheauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenWithDebug(t *testing.T) {
+	awsCfg := testAWSConfig("us-east-1")
+	creds, err := awsCfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() unexpected error: %v", err)
+	}
+	gen, err := NewElastiCache("my-user", "my-cache", awsCfg, WithClock(func() time.Time { return differentialTime }))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	token, debug, err := gen.TokenWithDebug(context.Background())
+	if err != nil {
+		t.Fatalf("TokenWithDebug() unexpected error: %v", err)
+	}
+	if want, _ := gen.Token(context.Background()); token != want {
+		t.Errorf("TokenWithDebug() token = %q, want the Token() result %q", token, want)
+	}
+	vals := parseToken(t, token)
+
+	if want := "20240301/us-east-1/elasticache/aws4_request"; debug.CredentialScope != want {
+		t.Errorf("CredentialScope = %q, want %q", debug.CredentialScope, want)
+	}
+	if debug.SignedHeaders != vals.Get("X-Amz-SignedHeaders") {
+		t.Errorf("SignedHeaders = %q, want %q", debug.SignedHeaders, vals.Get("X-Amz-SignedHeaders"))
+	}
+	if !strings.HasPrefix(debug.CanonicalRequest, "GET\n/\n") || !strings.Contains(debug.CanonicalRequest, "\nhost:my-cache\n") {
+		t.Errorf("CanonicalRequest = %q, want a GET of / for host my-cache", debug.CanonicalRequest)
+	}
+
+	// The string to sign must hash the canonical request, and signing it
+	// must give the token's signature.
+	lines := strings.Split(debug.StringToSign, "\n")
+	requestHash := sha256.Sum256([]byte(debug.CanonicalRequest))
+	if len(lines) != 4 || lines[2] != debug.CredentialScope || lines[3] != hex.EncodeToString(requestHash[:]) {
+		t.Fatalf("StringToSign = %q, want it to hash CanonicalRequest under CredentialScope", debug.StringToSign)
+	}
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), "20240301")
+	for _, part := range []string{"us-east-1", "elasticache", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if got := hex.EncodeToString(hmacSHA256(key, debug.StringToSign)); got != vals.Get("X-Amz-Signature") {
+		t.Errorf("signing StringToSign gives %q, want X-Amz-Signature %q", got, vals.Get("X-Amz-Signature"))
+	}
+}
+
+func TestTokenWithDebug_SigningError(t *testing.T) {
+	gen := newElastiCacheGenerator(t, WithMaxTokenLength(1))
+	if _, _, err := gen.TokenWithDebug(context.Background()); !errors.Is(err, ErrSigning) {
+		t.Errorf("TokenWithDebug() error = %v, want ErrSigning", err)
+	}
+}
@@ -0,0 +1,458 @@
+package iamcacheauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsv4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go/aws-http-auth/sigv4"
+	v4 "github.com/aws/smithy-go/aws-http-auth/v4"
+)
+
+// The differential tests compare tokens against two independent signers.
+// The AWS SDK's SigV4 presigner orders query parameters differently, so
+// tokens are compared with it by prefix and by parsed query. The smithy-go
+// signer, driven through an *http.Request as presign once did, must produce
+// identical bytes.
+
+// differentialTime is a fixed signing time so both signers agree on
+// X-Amz-Date.
+var differentialTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+// referenceInput describes a token to be presigned by the reference signer.
+type referenceInput struct {
+	creds       aws.Credentials
+	method      string
+	host        string
+	path        string
+	query       url.Values // Action, User, X-Amz-Expires and any ResourceType
+	service     string
+	region      string
+	payloadHash []byte // nil means the empty payload
+}
+
+// referenceToken presigns in with the AWS SDK signer and returns the result
+// with the scheme removed.
+func referenceToken(t testing.TB, in referenceInput) string {
+	t.Helper()
+	path := in.path
+	if path == "" {
+		path = "/"
+	}
+	method := in.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	payloadHash := in.payloadHash
+	if payloadHash == nil {
+		payloadHash = emptyPayloadHash[:]
+	}
+	req, err := http.NewRequest(method, "http://"+in.host+path+"?"+in.query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("failed to build reference request: %v", err)
+	}
+	signed, _, err := awsv4.NewSigner().PresignHTTP(context.Background(), in.creds, req,
+		hex.EncodeToString(payloadHash), in.service, in.region, differentialTime)
+	if err != nil {
+		t.Fatalf("reference PresignHTTP() failed: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("failed to parse reference URL: %v", err)
+	}
+	return withoutScheme(u)
+}
+
+// withoutScheme formats u as a token: host, escaped path and query, with
+// no scheme whatever it was.
+func withoutScheme(u *url.URL) string {
+	return u.Host + u.EscapedPath() + "?" + u.RawQuery
+}
+
+// assertMatchesReference checks that token has the same host, path and
+// query parameters (including the signature) as the reference token.
+func assertMatchesReference(t *testing.T, token, reference string) {
+	t.Helper()
+	gotPrefix, gotQuery, _ := strings.Cut(token, "?")
+	wantPrefix, wantQuery, _ := strings.Cut(reference, "?")
+	if gotPrefix != wantPrefix {
+		t.Errorf("token host/path = %q, want %q", gotPrefix, wantPrefix)
+	}
+	got, err := url.ParseQuery(gotQuery)
+	if err != nil {
+		t.Fatalf("failed to parse token query: %v", err)
+	}
+	want, err := url.ParseQuery(wantQuery)
+	if err != nil {
+		t.Fatalf("failed to parse reference query: %v", err)
+	}
+	if !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("token query does not match reference:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+// assertUserRoundTrips checks that the User parameter of token decodes to
+// user both as a form value and with strict percent-decoding, which does
+// not read "+" as a space.
+func assertUserRoundTrips(t *testing.T, token, user string) {
+	t.Helper()
+	_, rawQuery, _ := strings.Cut(token, "?")
+	for param := range strings.SplitSeq(rawQuery, "&") {
+		raw, ok := strings.CutPrefix(param, "User=")
+		if !ok {
+			continue
+		}
+		if got, err := url.QueryUnescape(raw); err != nil || got != user {
+			t.Errorf("User form-decodes to %q (err %v), want %q", got, err, user)
+		}
+		if got, err := url.PathUnescape(raw); err != nil || got != user {
+			t.Errorf("User percent-decodes to %q (err %v), want %q", got, err, user)
+		}
+		return
+	}
+	t.Errorf("token has no User parameter: %q", token)
+}
+
+// differentialToken signs a token with gen at differentialTime.
+func differentialToken(t *testing.T, gen *TokenGenerator) string {
+	t.Helper()
+	creds, err := gen.retrieveCredentials(context.Background())
+	if err != nil {
+		t.Fatalf("retrieveCredentials() unexpected error: %v", err)
+	}
+	token, err := gen.presign(gen.input(creds, gen.signingHost()), differentialTime)
+	if err != nil {
+		t.Fatalf("presign() unexpected error: %v", err)
+	}
+	return token
+}
+
+// connectQuery returns the non-SigV4 query parameters of a connect token.
+func connectQuery(user string) url.Values {
+	q := url.Values{}
+	q.Set("Action", "connect")
+	q.Set("User", user)
+	q.Set("X-Amz-Expires", "900")
+	return q
+}
+
+func actionQuery(action, user string) url.Values {
+	q := connectQuery(user)
+	q.Set("Action", action)
+	return q
+}
+
+func TestDifferential_VariedInputs(t *testing.T) {
+	awsCfg := testAWSConfig("us-east-1")
+	creds, err := awsCfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() unexpected error: %v", err)
+	}
+
+	serverlessQuery := connectQuery("my-user")
+	serverlessQuery.Set("ResourceType", "ServerlessCache")
+	shortExpiryQuery := connectQuery("my-user")
+	shortExpiryQuery.Set("X-Amz-Expires", "300")
+
+	tests := []struct {
+		name string
+		ctor func(userID, name string, awsCfg aws.Config, opts ...Option) (*TokenGenerator, error)
+		user string
+		host string
+		opts []Option
+		ref  referenceInput
+	}{
+		{
+			name: "elasticache",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			ref: referenceInput{query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "elasticache serverless",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithServerless()},
+			ref:  referenceInput{query: serverlessQuery, service: "elasticache"},
+		},
+		{
+			name: "memorydb",
+			ctor: NewMemoryDB, user: "my-user", host: "my-cluster",
+			ref: referenceInput{query: connectQuery("my-user"), service: "memorydb"},
+		},
+		{
+			name: "mixed-case hyphenated cache",
+			ctor: NewElastiCache, user: "my-user", host: "My-Cache-01",
+			ref: referenceInput{host: "my-cache-01", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "mixed-case hyphenated cluster",
+			ctor: NewMemoryDB, user: "my-user", host: "Prod-Cluster-A",
+			ref: referenceInput{host: "prod-cluster-a", query: connectQuery("my-user"), service: "memorydb"},
+		},
+		{
+			name: "mixed-case user",
+			ctor: NewElastiCache, user: "My-User", host: "My-Cache",
+			ref: referenceInput{host: "my-cache", query: connectQuery("My-User"), service: "elasticache"},
+		},
+		{
+			name: "email user",
+			ctor: NewElastiCache, user: "user@domain.com", host: "my-cache",
+			ref: referenceInput{query: connectQuery("user@domain.com"), service: "elasticache"},
+		},
+		{
+			name: "plus in user",
+			ctor: NewElastiCache, user: "app+ro", host: "my-cache",
+			ref: referenceInput{query: connectQuery("app+ro"), service: "elasticache"},
+		},
+		{
+			name: "slash in user",
+			ctor: NewElastiCache, user: "team/app", host: "my-cache",
+			opts: []Option{WithSkipUserValidation()},
+			ref:  referenceInput{query: connectQuery("team/app"), service: "elasticache"},
+		},
+		{
+			name: "equals in user",
+			ctor: NewElastiCache, user: "app=ro", host: "my-cache",
+			ref: referenceInput{query: connectQuery("app=ro"), service: "elasticache"},
+		},
+		{
+			name: "space in user",
+			ctor: NewElastiCache, user: "my app", host: "my-cache",
+			opts: []Option{WithSkipUserValidation()},
+			ref:  referenceInput{query: connectQuery("my app"), service: "elasticache"},
+		},
+		{
+			name: "custom path",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithPath("/custom/path")},
+			ref:  referenceInput{path: "/custom/path", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "escaped path",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithPath("/a b/~c%")},
+			ref:  referenceInput{path: "/a%20b/~c%25", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "host suffix",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithHostSuffix(".internal")},
+			ref:  referenceInput{host: "my-cache.internal", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "endpoint with port",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithEndpoint("cache.internal:6379")},
+			ref:  referenceInput{host: "cache.internal:6379", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "ipv6 endpoint",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithEndpoint("[::1]:6379")},
+			ref:  referenceInput{host: "[::1]:6379", query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "custom expiry",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithExpiry(5 * time.Minute)},
+			ref:  referenceInput{query: shortExpiryQuery, service: "elasticache"},
+		},
+		{
+			name: "post method",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithHTTPMethod(http.MethodPost)},
+			ref:  referenceInput{method: http.MethodPost, query: connectQuery("my-user"), service: "elasticache"},
+		},
+		{
+			name: "custom action",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithAction("migrate")},
+			ref:  referenceInput{query: actionQuery("migrate", "my-user"), service: "elasticache"},
+		},
+		{
+			name: "custom payload hash",
+			ctor: NewElastiCache, user: "my-user", host: "my-cache",
+			opts: []Option{WithPayloadHash(testPayloadHash[:])},
+			ref:  referenceInput{payloadHash: testPayloadHash[:], query: connectQuery("my-user"), service: "elasticache"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := tt.ctor(tt.user, tt.host, awsCfg, tt.opts...)
+			if err != nil {
+				t.Fatalf("constructor unexpected error: %v", err)
+			}
+			ref := tt.ref
+			ref.creds = creds
+			if ref.host == "" {
+				ref.host = tt.host
+			}
+			ref.region = "us-east-1"
+			token := differentialToken(t, gen)
+			assertMatchesReference(t, token, referenceToken(t, ref))
+			assertUserRoundTrips(t, token, tt.user)
+
+			creds, err := gen.retrieveCredentials(context.Background())
+			if err != nil {
+				t.Fatalf("retrieveCredentials() unexpected error: %v", err)
+			}
+			// smithy-go writes spaces in the query as "+" where tokens use
+			// %20; a literal "+" is %2B in both, so only spaces differ.
+			want := requestToken(t, gen, gen.input(creds, gen.signingHost()), differentialTime)
+			if want = strings.ReplaceAll(want, "+", "%20"); token != want {
+				t.Errorf("token differs from smithy-go signer:\n got: %q\nwant: %q", token, want)
+			}
+		})
+	}
+}
+
+// requestToken signs in through an *http.Request and the smithy-go signer,
+// with the scheme stripped from the resulting URL.
+func requestToken(tb testing.TB, gen *TokenGenerator, in signingInput, now time.Time) string {
+	tb.Helper()
+	query := url.Values{}
+	query.Set("Action", gen.cfg.action)
+	query.Set("User", in.user)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(gen.cfg.expiry/time.Second)))
+	if in.resourceType != "" {
+		query.Set("ResourceType", in.resourceType)
+	}
+	reqURL := &url.URL{Scheme: "http", Host: in.host, Path: gen.cfg.path, RawQuery: query.Encode()}
+	req, err := http.NewRequest(gen.cfg.method, reqURL.String(), nil)
+	if err != nil {
+		tb.Fatalf("failed to build request: %v", err)
+	}
+	if err := sigv4.New().SignRequest(&sigv4.SignRequestInput{
+		Request:       req,
+		PayloadHash:   gen.cfg.payloadHash,
+		Credentials:   in.creds,
+		Service:       in.service,
+		Region:        in.region,
+		Time:          now.UTC(),
+		SignatureType: v4.SignatureTypeQueryString,
+	}); err != nil {
+		tb.Fatalf("SignRequest() failed: %v", err)
+	}
+	return withoutScheme(req.URL)
+}
+
+func TestWithoutScheme(t *testing.T) {
+	for _, raw := range []string{
+		"http://my-cache/?Action=connect&User=my-user",
+		"https://my-cache/?Action=connect&User=my-user",
+		"HTTPS://my-cache/?Action=connect&User=my-user",
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("url.Parse(%q) failed: %v", raw, err)
+		}
+		if got, want := withoutScheme(u), "my-cache/?Action=connect&User=my-user"; got != want {
+			t.Errorf("withoutScheme(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func BenchmarkPresign(b *testing.B) {
+	gen, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"))
+	if err != nil {
+		b.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	creds, err := gen.retrieveCredentials(context.Background())
+	if err != nil {
+		b.Fatalf("retrieveCredentials() unexpected error: %v", err)
+	}
+	in := gen.input(creds, "my-cache")
+	now := time.Now()
+	b.Run("direct", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := gen.presign(in, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// Alternating credentials defeats the per-input query pieces and the
+	// signing key cache, so this is the cost of a token without them.
+	rotated := in
+	rotated.creds.SecretAccessKey += "-rotated"
+	b.Run("credentials-changing", func(b *testing.B) {
+		b.ReportAllocs()
+		i := 0
+		for b.Loop() {
+			next := in
+			if i++; i%2 == 0 {
+				next = rotated
+			}
+			if _, err := gen.presign(next, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("http-request", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = requestToken(b, gen, in, now)
+		}
+	})
+}
+
+func TestPresign_ChangingInputs(t *testing.T) {
+	gen := newElastiCacheGenerator(t)
+	creds, err := gen.retrieveCredentials(context.Background())
+	if err != nil {
+		t.Fatalf("retrieveCredentials() unexpected error: %v", err)
+	}
+	base := gen.input(creds, gen.signingHost())
+	rotated := base
+	rotated.creds.AccessKeyID = "ASIAROTATEDEXAMPLE"
+	rotated.creds.SessionToken = "rotated/session+token="
+	otherUser := base
+	otherUser.user = "other user"
+
+	// Each input is signed twice, around the others, so cached pieces and
+	// keys are checked both when built and when reused.
+	inputs := []signingInput{base, rotated, otherUser, base, rotated, otherUser}
+	for i, in := range inputs {
+		now := differentialTime.Add(time.Duration(i) * 24 * time.Hour)
+		got, err := gen.presign(in, now)
+		if err != nil {
+			t.Fatalf("presign() unexpected error: %v", err)
+		}
+		want := strings.ReplaceAll(requestToken(t, gen, in, now), "+", "%20")
+		if got != want {
+			t.Errorf("input %d: token differs from smithy-go signer:\n got: %q\nwant: %q", i, got, want)
+		}
+	}
+}
+
+func TestSigningKeyCache(t *testing.T) {
+	var c signingKeyCache
+	day1 := time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)
+	day2 := day1.Add(time.Second)
+	for _, tt := range []struct {
+		name                    string
+		secret, service, region string
+		now                     time.Time
+	}{
+		{"first", "secret", "elasticache", "us-east-1", day1},
+		{"same", "secret", "elasticache", "us-east-1", day1.Add(-time.Hour)},
+		{"next day", "secret", "elasticache", "us-east-1", day2},
+		{"rotated secret", "rotated", "elasticache", "us-east-1", day2},
+		{"other service", "rotated", "memorydb", "us-east-1", day2},
+		{"other region", "rotated", "memorydb", "eu-west-1", day2},
+	} {
+		got := c.get(tt.secret, tt.now, tt.service, tt.region).key
+		if want := signingKey(tt.secret, tt.now, tt.service, tt.region); !bytes.Equal(got, want) {
+			t.Errorf("%s: get() = %x, want %x", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package iamcacheauth
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEndpointGenerator(t *testing.T) *EndpointTokenGenerator {
+	t.Helper()
+	gen, err := NewElastiCacheWithEndpoints("my-user", "my-cache", map[string]string{
+		RolePrimary: "my-primary",
+		RoleReader:  "my-reader",
+	}, testAWSConfig("us-east-1"))
+	if err != nil {
+		t.Fatalf("NewElastiCacheWithEndpoints() unexpected error: %v", err)
+	}
+	return gen
+}
+
+func TestEndpointToken_SignsRoleHost(t *testing.T) {
+	gen := newEndpointGenerator(t)
+	for role, host := range map[string]string{RolePrimary: "my-primary", RoleReader: "my-reader"} {
+		t.Run(role, func(t *testing.T) {
+			token, err := gen.Token(context.Background(), role)
+			if err != nil {
+				t.Fatalf("Token(%q) unexpected error: %v", role, err)
+			}
+			if !strings.HasPrefix(token, host+"/?") {
+				t.Errorf("token should start with %q, got %q", host+"/?", token[:min(len(token), 30)])
+			}
+			vals := parseToken(t, token)
+			if got := vals.Get("User"); got != "my-user" {
+				t.Errorf("User = %q, want %q", got, "my-user")
+			}
+		})
+	}
+}
+
+func TestEndpointToken_UnknownRole(t *testing.T) {
+	gen := newEndpointGenerator(t)
+	if _, err := gen.Token(context.Background(), "writer"); err == nil {
+		t.Error("Token() with unknown role should return error")
+	}
+}
+
+func TestEndpointToken_MapIsCopied(t *testing.T) {
+	endpoints := map[string]string{RolePrimary: "my-primary"}
+	gen, err := NewElastiCacheWithEndpoints("my-user", "my-cache", endpoints, testAWSConfig("us-east-1"))
+	if err != nil {
+		t.Fatalf("NewElastiCacheWithEndpoints() unexpected error: %v", err)
+	}
+	endpoints[RolePrimary] = "changed"
+
+	token, err := gen.Token(context.Background(), RolePrimary)
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, "my-primary/?") {
+		t.Errorf("token should start with %q, got %q", "my-primary/?", token[:min(len(token), 30)])
+	}
+}
+
+func TestNewElastiCacheWithEndpoints_Validation(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints map[string]string
+	}{
+		{"nil", nil},
+		{"empty role", map[string]string{"": "my-primary"}},
+		{"empty host", map[string]string{RolePrimary: ""}},
+		{"host with space", map[string]string{RolePrimary: "bad host"}},
+		{"host with path", map[string]string{RolePrimary: "my-cache/x"}},
+		{"one bad host", map[string]string{RolePrimary: "my-primary", RoleReader: "my_reader"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewElastiCacheWithEndpoints("my-user", "my-cache", tt.endpoints, testAWSConfig("us-east-1"))
+			if err == nil {
+				t.Error("NewElastiCacheWithEndpoints() should return error")
+			}
+		})
+	}
+}
+
+func TestResourceNameFromEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"my-cache.abc123.ng.0001.use1.cache.amazonaws.com", "my-cache"},
+		{"master.my-cache.abc123.use1.cache.amazonaws.com", "my-cache"},
+		{"master.my-cache.abc123.use1.cache.amazonaws.com:6379", "my-cache"},
+		{"clustercfg.my-cache.abc123.use1.cache.amazonaws.com:6379", "my-cache"},
+		{"clustercfg.my-cluster.abc123.memorydb.us-east-1.amazonaws.com", "my-cluster"},
+		{"replica.my-cache.abc123.use1.cache.amazonaws.com", "my-cache"},
+		{"replica.my-cache.abc123.use1.cache.amazonaws.com:6379", "my-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := ResourceNameFromEndpoint(tt.endpoint)
+			if err != nil {
+				t.Fatalf("ResourceNameFromEndpoint() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResourceNameFromEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceNameFromEndpoint_Invalid(t *testing.T) {
+	for _, endpoint := range []string{
+		"",
+		"my-cache",
+		"master.",
+		".abc123.use1.cache.amazonaws.com",
+		"my-cache-abc123.serverless.use1.cache.amazonaws.com:6379",
+		// Node endpoints name a node, not the replication group.
+		"my-cache-001.abc123.0001.use1.cache.amazonaws.com",
+		"my-cache-0001-002.abc123.0001.use1.cache.amazonaws.com:6379",
+		// Non-TLS reader endpoints carry a "-ro" suffix.
+		"my-cache-ro.abc123.ng.0001.use1.cache.amazonaws.com",
+	} {
+		if _, err := ResourceNameFromEndpoint(endpoint); err == nil {
+			t.Errorf("ResourceNameFromEndpoint(%q) should return error", endpoint)
+		}
+	}
+}
+
+func TestToken_FromEndpointResourceName(t *testing.T) {
+	name, err := ResourceNameFromEndpoint("master.my-cache.abc123.use1.cache.amazonaws.com:6379")
+	if err != nil {
+		t.Fatalf("ResourceNameFromEndpoint() unexpected error: %v", err)
+	}
+	gen, err := NewElastiCache("my-user", name, testAWSConfig("us-east-1"))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	token, err := gen.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, "my-cache/?") {
+		t.Errorf("token should start with %q, got %q", "my-cache/?", token[:min(len(token), 30)])
+	}
+	if got := parseToken(t, token).Get("User"); got != "my-user" {
+		t.Errorf("User = %q, want %q", got, "my-user")
+	}
+}
+
+func TestConnectionURL(t *testing.T) {
+	gen := newElastiCacheGenerator(t, WithExpiry(10*time.Minute))
+	tests := []struct {
+		host     string
+		wantHost string
+	}{
+		{host: "master.my-cache.abc123.use1.cache.amazonaws.com", wantHost: "master.my-cache.abc123.use1.cache.amazonaws.com:6379"},
+		{host: "::1", wantHost: "[::1]:6379"},
+		{host: "[fd00::1]", wantHost: "[fd00::1]:6379"},
+	}
+	for _, tt := range tests {
+		raw, err := gen.ConnectionURL(context.Background(), tt.host, 6379)
+		if err != nil {
+			t.Fatalf("ConnectionURL(%q) unexpected error: %v", tt.host, err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("url.Parse(ConnectionURL(%q)) unexpected error: %v", tt.host, err)
+		}
+		if u.Scheme != "rediss" {
+			t.Errorf("scheme = %q, want %q", u.Scheme, "rediss")
+		}
+		if u.Host != tt.wantHost {
+			t.Errorf("host = %q, want %q", u.Host, tt.wantHost)
+		}
+		if got := u.User.Username(); got != "my-user" {
+			t.Errorf("username = %q, want %q", got, "my-user")
+		}
+		token, _ := u.User.Password()
+		vals := parseToken(t, token)
+		if !strings.HasPrefix(token, "my-cache/?") || vals.Get("X-Amz-Expires") != "600" {
+			t.Errorf("password does not decode to a token for my-cache: %q", token)
+		}
+	}
+
+	for _, port := range []int{0, 65536} {
+		if _, err := gen.ConnectionURL(context.Background(), "my-host", port); err == nil {
+			t.Errorf("ConnectionURL() with port %d should return error", port)
+		}
+	}
+	for _, host := range []string{"", "[]"} {
+		if _, err := gen.ConnectionURL(context.Background(), host, 6379); err == nil {
+			t.Errorf("ConnectionURL(%q) should return error", host)
+		}
+	}
+	for _, host := range []string{"host.example.com:6379", "10.0.0.1:6379"} {
+		if _, err := gen.ConnectionURL(context.Background(), host, 6379); err == nil {
+			t.Errorf("ConnectionURL(%q) with a port in the host should return error", host)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// FailoverTarget is one member of a [FailoverGenerator]: a cache in a
+// region, such as a member of an ElastiCache Global Datastore.
+//
+// Credentials, if set, signs this target's tokens in place of the
+// aws.Config given to [NewElastiCacheFailover], so that a fallback can use
+// an independent credential source, such as a role assumed through its own
+// region's STS endpoint. A target holding a func-typed provider, such as
+// [aws.CredentialsProviderFunc], cannot be compared with ==.
+type FailoverTarget struct {
+	Region       string
+	ResourceName string
+	Credentials  aws.CredentialsProvider
+}
+
+// FailoverGenerator mints a token for the first of an ordered list of
+// targets whose credentials can be retrieved, so services using a Global
+// Datastore share one fallback policy. It is safe for concurrent use after
+// construction.
+//
+// Use [NewElastiCacheFailover] to create instances.
+type FailoverGenerator struct {
+	targets []FailoverTarget
+	gens    []*TokenGenerator
+}
+
+// NewElastiCacheFailover creates a [FailoverGenerator] for ElastiCache with
+// targets in order of preference. Each target's generator is built as by
+// [NewElastiCache] with opts, and its region overrides awsCfg.Region and
+// any [WithRegion] in opts. targets is copied.
+//
+// Targets without their own Credentials share awsCfg's provider through a
+// single credentials cache, so they cost one retrieval between them. A
+// credential failure on such a target is retried against the same provider
+// on the next, which helps only when the failure is transient; falling
+// back past a provider that is down needs a target with its own
+// Credentials.
+func NewElastiCacheFailover(userID string, targets []FailoverTarget, awsCfg aws.Config, opts ...Option) (*FailoverGenerator, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("iamcacheauth: failover targets must not be empty")
+	}
+	base, err := applyOptions(tokenConfig{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	shared := cachedProvider(awsCfg.Credentials, base.cacheOptions...)
+
+	f := &FailoverGenerator{targets: make([]FailoverTarget, len(targets))}
+	copy(f.targets, targets)
+	for _, target := range f.targets {
+		targetCfg := awsCfg
+		targetCfg.Credentials = shared
+		if target.Credentials != nil {
+			targetCfg.Credentials = target.Credentials
+		}
+		gen, err := NewElastiCache(userID, target.ResourceName, targetCfg, append(opts[:len(opts):len(opts)], WithRegion(target.Region))...)
+		if err != nil {
+			return nil, fmt.Errorf("iamcacheauth: failover target %s in %s: %w", target.ResourceName, target.Region, err)
+		}
+		f.gens = append(f.gens, gen)
+	}
+	return f, nil
+}
+
+// Token returns a fresh token from the first target that can mint one.
+// See [FailoverGenerator.TokenDetailed].
+func (f *FailoverGenerator) Token(ctx context.Context) (string, error) {
+	res, _, err := f.TokenDetailed(ctx)
+	return res.Raw, err
+}
+
+// TokenDetailed tries each target in order and returns the first token
+// minted, as a [TokenResult], with the target it was minted for.
+//
+// Only credential failures ([ErrCredentialRetrieval] and
+// [ErrCredentialsExpired]) move on to the next target; any other error,
+// or a done ctx, is returned at once. If every target fails, the error joins
+// each target's failure.
+func (f *FailoverGenerator) TokenDetailed(ctx context.Context) (TokenResult, FailoverTarget, error) {
+	var errs []error
+	for i, gen := range f.gens {
+		res, err := gen.TokenDetailed(ctx)
+		if err == nil {
+			return res, f.targets[i], nil
+		}
+		if ctx.Err() != nil || !errors.Is(err, ErrCredentialRetrieval) && !errors.Is(err, ErrCredentialsExpired) {
+			return TokenResult{}, FailoverTarget{}, err
+		}
+		errs = append(errs, fmt.Errorf("%s in %s: %w", f.targets[i].ResourceName, f.targets[i].Region, err))
+	}
+	return TokenResult{}, FailoverTarget{}, fmt.Errorf("iamcacheauth: every failover target failed: %w", errors.Join(errs...))
+}
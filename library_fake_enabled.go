@@ -0,0 +1,15 @@
+//go:build iamcacheauth_fake
+
+package iamcacheauth
+
+// WithFakeSigner makes the generator produce deterministic, clearly fake
+// tokens for offline tests: they use built-in fake credentials in place of
+// the configured provider, and carry the signature
+// "IAMCACHEAUTH-FAKE-SIGNATURE". With a fixed signing time, the output is
+// identical on every run.
+//
+// This option only exists in builds with the iamcacheauth_fake build tag.
+// Tokens it produces are always rejected by ElastiCache and MemoryDB.
+func WithFakeSigner() Option {
+	return withFakeSigner()
+}
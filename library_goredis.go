@@ -0,0 +1,23 @@
+package iamcacheauth
+
+import "context"
+
+// GoRedisCredentialsProvider returns a callback for go-redis v9's
+// Options.CredentialsProviderContext, yielding username and a fresh token
+// from gen on every connection. An empty username means the user ID gen
+// signs for, which is what ElastiCache and MemoryDB expect.
+//
+// The callback's type is spelled out rather than imported, so using it does
+// not make go-redis a dependency of this package.
+func GoRedisCredentialsProvider(gen *TokenGenerator, username string) func(ctx context.Context) (string, string, error) {
+	if username == "" {
+		username = gen.cfg.userID
+	}
+	return func(ctx context.Context) (string, string, error) {
+		token, err := gen.Token(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		return username, token, nil
+	}
+}
@@ -0,0 +1,47 @@
+package iamcacheauth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestGoRedisCredentialsProvider(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		provider := GoRedisCredentialsProvider(newElastiCacheGenerator(t), "")
+
+		user, first, err := provider(context.Background())
+		if err != nil {
+			t.Fatalf("provider() unexpected error: %v", err)
+		}
+		if user != "my-user" {
+			t.Errorf("username = %q, want %q", user, "my-user")
+		}
+		if !strings.HasPrefix(first, "my-cache/?") {
+			t.Errorf("password should start with %q, got %q", "my-cache/?", first[:min(len(first), 30)])
+		}
+
+		// Each reconnect gets a newly signed token.
+		time.Sleep(time.Second)
+		_, second, err := provider(context.Background())
+		if err != nil {
+			t.Fatalf("provider() unexpected error: %v", err)
+		}
+		if second == first {
+			t.Error("provider() should sign a fresh token per call")
+		}
+	})
+}
+
+func TestGoRedisCredentialsProvider_Username(t *testing.T) {
+	provider := GoRedisCredentialsProvider(newElastiCacheGenerator(t), "other-user")
+	user, _, err := provider(context.Background())
+	if err != nil {
+		t.Fatalf("provider() unexpected error: %v", err)
+	}
+	if user != "other-user" {
+		t.Errorf("username = %q, want %q", user, "other-user")
+	}
+}
@@ -0,0 +1,166 @@
+package iamcacheauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WithLogger makes the generator log each token it returns at debug level
+// and each credential or signing failure at error level. Records carry the
+// service, region, resource, host, user and X-Amz-Date, never the
+// signature, the token or any credential, and are logged with the caller's
+// context, including any ID from [ContextWithRequestID] as request_id.
+// Without it nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(cfg *tokenConfig) error {
+		if l == nil {
+			return fmt.Errorf("iamcacheauth: logger must not be nil")
+		}
+		cfg.logger = l
+		return nil
+	}
+}
+
+// WithOnTokenGenerated makes the generator call fn with the service and
+// expiry time of each token it returns. fn runs synchronously on the
+// calling goroutine, so it must be cheap and must not block.
+func WithOnTokenGenerated(fn func(service string, expiresAt time.Time)) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: token generated callback must not be nil")
+		}
+		cfg.onToken = fn
+		return nil
+	}
+}
+
+// WithOnError makes the generator call fn with each credential or signing
+// failure it returns. fn runs synchronously on the calling goroutine, so it
+// must be cheap and must not block.
+func WithOnError(fn func(err error)) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: error callback must not be nil")
+		}
+		cfg.onError = fn
+		return nil
+	}
+}
+
+// requestIDKey is the context key for [ContextWithRequestID].
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id, so that a token
+// generated with it can be attributed in logs: [WithLogger] records include
+// it as request_id, and the callbacks set by [WithOnTokenGeneratedContext]
+// and [WithOnErrorContext] receive ctx, from which [RequestIDFromContext]
+// recovers it. The ID is never signed or added to the token.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID set on ctx by [ContextWithRequestID],
+// if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// WithOnTokenGeneratedContext is [WithOnTokenGenerated] with the context
+// of the call that generated the token, for hooks that correlate by
+// request ID or trace span. It may be combined with WithOnTokenGenerated,
+// which is called first.
+func WithOnTokenGeneratedContext(fn func(ctx context.Context, service string, expiresAt time.Time)) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: token generated callback must not be nil")
+		}
+		cfg.onTokenCtx = fn
+		return nil
+	}
+}
+
+// WithOnErrorContext is [WithOnError] with the context of the failed call.
+// It may be combined with WithOnError, which is called first.
+func WithOnErrorContext(fn func(ctx context.Context, err error)) Option {
+	return func(cfg *tokenConfig) error {
+		if fn == nil {
+			return fmt.Errorf("iamcacheauth: error callback must not be nil")
+		}
+		cfg.onErrorCtx = fn
+		return nil
+	}
+}
+
+// tokenGenerated reports a token signed for in at now, by a call made with
+// ctx, to the logger and callbacks, if set.
+func (g *TokenGenerator) tokenGenerated(ctx context.Context, in signingInput, now time.Time) {
+	if g.cfg.onToken != nil || g.cfg.onTokenCtx != nil {
+		expires := g.info(in, now).Expires
+		if g.cfg.onToken != nil {
+			g.cfg.onToken(in.service, expires)
+		}
+		if g.cfg.onTokenCtx != nil {
+			g.cfg.onTokenCtx(ctx, in.service, expires)
+		}
+	}
+	l := g.cfg.logger
+	if l == nil || !l.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	l.LogAttrs(ctx, slog.LevelDebug, "iamcacheauth: token generated", withRequestID(ctx,
+		slog.String("service", in.service),
+		slog.String("region", in.region),
+		slog.String("resource", g.cfg.resourceName),
+		slog.String("host", in.host),
+		slog.String("user", in.user),
+		slog.String("x_amz_date", now.UTC().Format(sigv4TimeFormat)),
+	)...)
+}
+
+// tokenFailed reports a failure to produce a token to the logger and
+// callbacks, if set.
+func (g *TokenGenerator) tokenFailed(ctx context.Context, msg string, err error) {
+	if g.cfg.onError != nil {
+		g.cfg.onError(err)
+	}
+	if g.cfg.onErrorCtx != nil {
+		g.cfg.onErrorCtx(ctx, err)
+	}
+	l := g.cfg.logger
+	if l == nil {
+		return
+	}
+	l.LogAttrs(ctx, slog.LevelError, msg, withRequestID(ctx,
+		slog.String("service", g.cfg.serviceName),
+		slog.String("region", g.cfg.region),
+		slog.String("resource", g.cfg.resourceName),
+		slog.Any("error", err),
+	)...)
+}
+
+// staleTokenServed logs that a cached token expiring at expires was returned
+// in place of err, if a logger is set.
+func (g *TokenGenerator) staleTokenServed(ctx context.Context, expires time.Time, err error) {
+	l := g.cfg.logger
+	if l == nil {
+		return
+	}
+	l.LogAttrs(ctx, slog.LevelWarn, "iamcacheauth: refresh failed, serving cached token", withRequestID(ctx,
+		slog.String("service", g.cfg.serviceName),
+		slog.String("region", g.cfg.region),
+		slog.String("resource", g.cfg.resourceName),
+		slog.Time("expires", expires),
+		slog.Any("error", err),
+	)...)
+}
+
+// withRequestID appends ctx's request ID, if any, to attrs.
+func withRequestID(ctx context.Context, attrs ...slog.Attr) []slog.Attr {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	return attrs
+}
@@ -0,0 +1,226 @@
+package iamcacheauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// newTestLogger returns a JSON logger at debug level writing to buf.
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestWithLogger_TokenGenerated(t *testing.T) {
+	var buf bytes.Buffer
+	gen := newElastiCacheGenerator(t, WithLogger(newTestLogger(&buf)))
+	token, err := gen.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	vals := parseToken(t, token)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":      "DEBUG",
+		"msg":        "iamcacheauth: token generated",
+		"service":    "elasticache",
+		"region":     "us-east-1",
+		"resource":   "my-cache",
+		"host":       "my-cache",
+		"user":       "my-user",
+		"x_amz_date": vals.Get("X-Amz-Date"),
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("record[%q] = %v, want %v", key, record[key], value)
+		}
+	}
+	for _, secret := range []string{vals.Get("X-Amz-Signature"), vals.Get("X-Amz-Security-Token"), token} {
+		if secret != "" && strings.Contains(buf.String(), secret) {
+			t.Errorf("log record %q should not contain %q", buf.String(), secret)
+		}
+	}
+}
+
+func TestWithLogger_CredentialFailure(t *testing.T) {
+	var buf bytes.Buffer
+	gen, err := NewElastiCache("my-user", "my-cache", aws.Config{
+		Region:      "us-east-1",
+		Credentials: failingCredentials{err: errors.New("cred boom")},
+	}, WithLogger(newTestLogger(&buf)))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	if _, err := gen.Token(context.Background()); err == nil {
+		t.Fatal("Token() should return error when credentials fail")
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["level"] != "ERROR" {
+		t.Errorf("level = %v, want ERROR", record["level"])
+	}
+	if errMsg, _ := record["error"].(string); !strings.Contains(errMsg, "cred boom") {
+		t.Errorf("error = %v, want the wrapped credential error", record["error"])
+	}
+}
+
+func TestWithLogger_DebugDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	gen := newElastiCacheGenerator(t, WithLogger(l))
+	if _, err := gen.Token(context.Background()); err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("debug records should be dropped at info level, got %q", buf.String())
+	}
+}
+
+func TestWithLogger_Nil(t *testing.T) {
+	if _, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"), WithLogger(nil)); err == nil {
+		t.Error("WithLogger(nil) should return error")
+	}
+}
+
+func TestWithOnTokenGenerated(t *testing.T) {
+	var calls int
+	var gotService string
+	var gotExpires time.Time
+	gen := newMemoryDBGenerator(t, WithOnTokenGenerated(func(service string, expiresAt time.Time) {
+		calls++
+		gotService, gotExpires = service, expiresAt
+	}))
+	_, info, err := gen.TokenAndInfo(context.Background())
+	if err != nil {
+		t.Fatalf("TokenAndInfo() unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+	if gotService != "memorydb" {
+		t.Errorf("service = %q, want %q", gotService, "memorydb")
+	}
+	if !gotExpires.Equal(info.Expires) {
+		t.Errorf("expiresAt = %v, want %v", gotExpires, info.Expires)
+	}
+}
+
+func TestWithOnError(t *testing.T) {
+	sentinel := errors.New("cred boom")
+	var got []error
+	gen, err := NewElastiCache("my-user", "my-cache", aws.Config{
+		Region:      "us-east-1",
+		Credentials: failingCredentials{err: sentinel},
+	}, WithOnError(func(err error) { got = append(got, err) }),
+		WithOnTokenGenerated(func(string, time.Time) { t.Error("token callback called on failure") }))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	_, err = gen.Token(context.Background())
+	if len(got) != 1 || got[0] != err {
+		t.Fatalf("error callback got %v, want the returned error %v once", got, err)
+	}
+	if !errors.Is(got[0], sentinel) {
+		t.Errorf("callback error = %v, want it to wrap the credential error", got[0])
+	}
+
+	got = nil
+	signing := newElastiCacheGenerator(t, WithMaxTokenLength(1), WithOnError(func(err error) { got = append(got, err) }))
+	if _, err := signing.Token(context.Background()); len(got) != 1 || !errors.Is(got[0], ErrSigning) || got[0] != err {
+		t.Errorf("error callback got %v, want the returned signing error %v once", got, err)
+	}
+}
+
+func TestCallbacks_Nil(t *testing.T) {
+	if _, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"), WithOnTokenGenerated(nil)); err == nil {
+		t.Error("WithOnTokenGenerated(nil) should return error")
+	}
+	if _, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"), WithOnError(nil)); err == nil {
+		t.Error("WithOnError(nil) should return error")
+	}
+}
+
+func TestContextWithRequestID(t *testing.T) {
+	const id = "req-7f3a91"
+	var buf bytes.Buffer
+	var tokenIDs, errorIDs []string
+	clock := WithClock(func() time.Time { return differentialTime })
+	gen := newElastiCacheGenerator(t, clock, WithLogger(newTestLogger(&buf)),
+		WithOnTokenGeneratedContext(func(ctx context.Context, _ string, _ time.Time) {
+			got, _ := RequestIDFromContext(ctx)
+			tokenIDs = append(tokenIDs, got)
+		}))
+
+	ctx := ContextWithRequestID(context.Background(), id)
+	token, err := gen.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["request_id"] != id {
+		t.Errorf("record[request_id] = %v, want %q", record["request_id"], id)
+	}
+	if len(tokenIDs) != 1 || tokenIDs[0] != id {
+		t.Errorf("token callback saw request IDs %q, want [%q]", tokenIDs, id)
+	}
+
+	// The ID is not signed: the token matches one generated without it.
+	if strings.Contains(token, id) {
+		t.Errorf("token %q should not contain the request ID", token)
+	}
+	plain, err := newElastiCacheGenerator(t, clock).Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if token != plain {
+		t.Errorf("token with a request ID = %q, want %q as without one", token, plain)
+	}
+
+	buf.Reset()
+	failing, err := NewElastiCache("my-user", "my-cache", aws.Config{
+		Region:      "us-east-1",
+		Credentials: failingCredentials{err: errors.New("cred boom")},
+	}, WithLogger(newTestLogger(&buf)), WithOnErrorContext(func(ctx context.Context, _ error) {
+		got, _ := RequestIDFromContext(ctx)
+		errorIDs = append(errorIDs, got)
+	}))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	if _, err := failing.Token(ctx); err == nil {
+		t.Fatal("Token() should return error when credentials fail")
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["request_id"] != id {
+		t.Errorf("failure record[request_id] = %v, want %q", record["request_id"], id)
+	}
+	if len(errorIDs) != 1 || errorIDs[0] != id {
+		t.Errorf("error callback saw request IDs %q, want [%q]", errorIDs, id)
+	}
+}
+
+func TestRequestIDFromContext_Unset(t *testing.T) {
+	if id, ok := RequestIDFromContext(context.Background()); ok || id != "" {
+		t.Errorf("RequestIDFromContext() = %q, %v, want unset", id, ok)
+	}
+}
@@ -0,0 +1,83 @@
+package iamcacheauth
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// iamPolicy is the subset of the IAM policy grammar needed for
+// [TokenGenerator.ExampleIAMPolicy].
+type iamPolicy struct {
+	Version   string               `json:"Version"`
+	Statement []iamPolicyStatement `json:"Statement"`
+}
+
+type iamPolicyStatement struct {
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// RequiredIAMActions returns the IAM actions the caller's principal must be
+// allowed in order to connect with tokens from this generator.
+func (g *TokenGenerator) RequiredIAMActions() []string {
+	if g.cfg.serviceName == "memorydb" {
+		return []string{"memorydb:connect"}
+	}
+	return []string{"elasticache:Connect"}
+}
+
+// ExampleIAMPolicy returns a minimal IAM policy document, as indented JSON,
+// that allows [TokenGenerator.RequiredIAMActions] on the generator's
+// resource and user in the given AWS account. accountID must be a 12-digit
+// AWS account ID.
+//
+// The policy is a starting point: it does not include condition keys, and
+// it assumes the user ID and user name are the same.
+func (g *TokenGenerator) ExampleIAMPolicy(accountID string) (string, error) {
+	if !isAccountID(accountID) {
+		return "", fmt.Errorf("iamcacheauth: account ID %q must be 12 digits", accountID)
+	}
+
+	policy := iamPolicy{
+		Version: "2012-10-17",
+		Statement: []iamPolicyStatement{{
+			Effect:   "Allow",
+			Action:   g.RequiredIAMActions(),
+			Resource: []string{g.resourceARN(accountID), g.userARN(accountID)},
+		}},
+	}
+
+	b, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("iamcacheauth: failed to encode policy: %w", err)
+	}
+	return string(b), nil
+}
+
+// resourceARN returns the ARN of the cache or cluster targeted by g.
+func (g *TokenGenerator) resourceARN(accountID string) string {
+	prefix := "arn:" + partition(g.cfg.region) + ":" + g.cfg.serviceName + ":" + g.cfg.region + ":" + accountID + ":"
+	switch {
+	case g.cfg.serviceName == "memorydb":
+		return prefix + "cluster/" + g.cfg.resourceName
+	case g.cfg.resourceType == serverlessResourceType:
+		return prefix + "serverlesscache:" + g.cfg.resourceName
+	default:
+		return prefix + "replicationgroup:" + g.cfg.resourceName
+	}
+}
+
+// userARN returns the ARN of the cache user configured on g.
+func (g *TokenGenerator) userARN(accountID string) string {
+	prefix := "arn:" + partition(g.cfg.region) + ":" + g.cfg.serviceName + ":" + g.cfg.region + ":" + accountID + ":"
+	if g.cfg.serviceName == "memorydb" {
+		return prefix + "user/" + g.cfg.userID
+	}
+	return prefix + "user:" + g.cfg.userID
+}
+
+// isAccountID reports whether s is a 12-digit AWS account ID.
+func isAccountID(s string) bool {
+	return len(s) == 12 && allDigits(s)
+}
@@ -0,0 +1,100 @@
+package iamcacheauth
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestRequiredIAMActions(t *testing.T) {
+	if got := newElastiCacheGenerator(t).RequiredIAMActions(); !slices.Equal(got, []string{"elasticache:Connect"}) {
+		t.Errorf("ElastiCache RequiredIAMActions() = %v, want [elasticache:Connect]", got)
+	}
+	if got := newMemoryDBGenerator(t).RequiredIAMActions(); !slices.Equal(got, []string{"memorydb:connect"}) {
+		t.Errorf("MemoryDB RequiredIAMActions() = %v, want [memorydb:connect]", got)
+	}
+}
+
+func TestExampleIAMPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		gen           *TokenGenerator
+		wantAction    string
+		wantResources []string
+	}{
+		{
+			name:       "elasticache",
+			gen:        newElastiCacheGenerator(t),
+			wantAction: "elasticache:Connect",
+			wantResources: []string{
+				"arn:aws:elasticache:us-east-1:123456789012:replicationgroup:my-cache",
+				"arn:aws:elasticache:us-east-1:123456789012:user:my-user",
+			},
+		},
+		{
+			name:       "elasticache serverless",
+			gen:        newElastiCacheGenerator(t, WithServerless()),
+			wantAction: "elasticache:Connect",
+			wantResources: []string{
+				"arn:aws:elasticache:us-east-1:123456789012:serverlesscache:my-cache",
+				"arn:aws:elasticache:us-east-1:123456789012:user:my-user",
+			},
+		},
+		{
+			name:       "memorydb",
+			gen:        newMemoryDBGenerator(t),
+			wantAction: "memorydb:connect",
+			wantResources: []string{
+				"arn:aws:memorydb:us-east-1:123456789012:cluster/my-cluster",
+				"arn:aws:memorydb:us-east-1:123456789012:user/my-user",
+			},
+		},
+		{
+			name:       "govcloud",
+			gen:        newElastiCacheGenerator(t, WithRegion("us-gov-west-1")),
+			wantAction: "elasticache:Connect",
+			wantResources: []string{
+				"arn:aws-us-gov:elasticache:us-gov-west-1:123456789012:replicationgroup:my-cache",
+				"arn:aws-us-gov:elasticache:us-gov-west-1:123456789012:user:my-user",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := tt.gen.ExampleIAMPolicy("123456789012")
+			if err != nil {
+				t.Fatalf("ExampleIAMPolicy() unexpected error: %v", err)
+			}
+
+			var policy iamPolicy
+			if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+				t.Fatalf("ExampleIAMPolicy() returned invalid JSON: %v\n%s", err, doc)
+			}
+			if policy.Version != "2012-10-17" {
+				t.Errorf("Version = %q, want %q", policy.Version, "2012-10-17")
+			}
+			if len(policy.Statement) != 1 {
+				t.Fatalf("len(Statement) = %d, want 1", len(policy.Statement))
+			}
+			stmt := policy.Statement[0]
+			if stmt.Effect != "Allow" {
+				t.Errorf("Effect = %q, want %q", stmt.Effect, "Allow")
+			}
+			if !slices.Equal(stmt.Action, []string{tt.wantAction}) {
+				t.Errorf("Action = %v, want [%s]", stmt.Action, tt.wantAction)
+			}
+			if !slices.Equal(stmt.Resource, tt.wantResources) {
+				t.Errorf("Resource = %v, want %v", stmt.Resource, tt.wantResources)
+			}
+		})
+	}
+}
+
+func TestExampleIAMPolicy_InvalidAccountID(t *testing.T) {
+	gen := newElastiCacheGenerator(t)
+	for _, id := range []string{"", "12345", "12345678901a", "1234567890123"} {
+		if _, err := gen.ExampleIAMPolicy(id); err == nil {
+			t.Errorf("ExampleIAMPolicy(%q) should return error", id)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package iamcacheauth
+
+import (
+	"context"
+	"time"
+)
+
+// TokenInfo describes a generated token. It is populated from the inputs to
+// signing rather than by parsing the token.
+type TokenInfo struct {
+	User     string    // User query parameter
+	Region   string    // region in the credential scope
+	Service  string    // signing name in the credential scope
+	IssuedAt time.Time // signing time (X-Amz-Date), UTC, whole seconds
+	Expires  time.Time // IssuedAt plus X-Amz-Expires
+}
+
+// TokenAndInfo generates a fresh token like [TokenGenerator.Token] and
+// returns it together with its [TokenInfo], saving callers that log or cache
+// tokens from parsing them.
+func (g *TokenGenerator) TokenAndInfo(ctx context.Context) (string, TokenInfo, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return "", TokenInfo{}, err
+	}
+
+	now := g.cfg.clock()
+	in := g.input(creds, g.signingHost())
+	token, err := g.sign(ctx, in, now)
+	if err != nil {
+		return "", TokenInfo{}, err
+	}
+
+	return token, g.info(in, now), nil
+}
+
+// info describes the token signed for in at now.
+func (g *TokenGenerator) info(in signingInput, now time.Time) TokenInfo {
+	// X-Amz-Date has one-second resolution, so the effective signing time
+	// is truncated to match it.
+	issuedAt := now.UTC().Truncate(time.Second)
+	return TokenInfo{
+		User:     in.user,
+		Region:   in.region,
+		Service:  in.service,
+		IssuedAt: issuedAt,
+		Expires:  issuedAt.Add(g.cfg.expiry),
+	}
+}
+
+// RefreshAfter returns how long to wait from now before replacing the token
+// so that it is refreshed margin ahead of its expiry. It is zero if the
+// token is already within margin of expiring, or has expired.
+func (ti TokenInfo) RefreshAfter(margin time.Duration, now time.Time) time.Duration {
+	return max(ti.Expires.Sub(now)-margin, 0)
+}
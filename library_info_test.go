@@ -0,0 +1,100 @@
+package iamcacheauth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestTokenAndInfo_MatchesToken(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// Move off a whole second so truncation is exercised.
+		time.Sleep(1500 * time.Millisecond)
+
+		gen := newMemoryDBGenerator(t)
+		token, info, err := gen.TokenAndInfo(context.Background())
+		if err != nil {
+			t.Fatalf("TokenAndInfo() unexpected error: %v", err)
+		}
+		vals := parseToken(t, token)
+
+		if info.User != vals.Get("User") {
+			t.Errorf("User = %q, want %q", info.User, vals.Get("User"))
+		}
+		scope := strings.Split(vals.Get("X-Amz-Credential"), "/")
+		if info.Region != scope[2] {
+			t.Errorf("Region = %q, want %q", info.Region, scope[2])
+		}
+		if info.Service != scope[3] {
+			t.Errorf("Service = %q, want %q", info.Service, scope[3])
+		}
+
+		issuedAt, err := time.Parse("20060102T150405Z", vals.Get("X-Amz-Date"))
+		if err != nil {
+			t.Fatalf("failed to parse X-Amz-Date: %v", err)
+		}
+		if !info.IssuedAt.Equal(issuedAt) {
+			t.Errorf("IssuedAt = %v, want %v", info.IssuedAt, issuedAt)
+		}
+		if info.IssuedAt.Location() != time.UTC {
+			t.Errorf("IssuedAt location = %v, want UTC", info.IssuedAt.Location())
+		}
+
+		expires, err := strconv.Atoi(vals.Get("X-Amz-Expires"))
+		if err != nil {
+			t.Fatalf("failed to parse X-Amz-Expires: %v", err)
+		}
+		if want := issuedAt.Add(time.Duration(expires) * time.Second); !info.Expires.Equal(want) {
+			t.Errorf("Expires = %v, want %v", info.Expires, want)
+		}
+	})
+}
+
+func TestTokenWithExpiry(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		time.Sleep(1500 * time.Millisecond)
+
+		gen := newElastiCacheGenerator(t)
+		token, expires, err := gen.TokenWithExpiry(context.Background())
+		if err != nil {
+			t.Fatalf("TokenWithExpiry() unexpected error: %v", err)
+		}
+		vals := parseToken(t, token)
+		issuedAt, err := time.Parse("20060102T150405Z", vals.Get("X-Amz-Date"))
+		if err != nil {
+			t.Fatalf("failed to parse X-Amz-Date: %v", err)
+		}
+		if want := issuedAt.Add(15 * time.Minute); !expires.Equal(want) {
+			t.Errorf("expires = %v, want %v", expires, want)
+		}
+		if expires.Location() != time.UTC {
+			t.Errorf("expires location = %v, want UTC", expires.Location())
+		}
+	})
+}
+
+func TestTokenInfo_RefreshAfter(t *testing.T) {
+	issuedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	info := TokenInfo{IssuedAt: issuedAt, Expires: issuedAt.Add(15 * time.Minute)}
+	margin := time.Minute
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{name: "fresh", now: issuedAt, want: 14 * time.Minute},
+		{name: "inside margin", now: issuedAt.Add(14*time.Minute + 30*time.Second), want: 0},
+		{name: "expired", now: issuedAt.Add(20 * time.Minute), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := info.RefreshAfter(margin, tt.now); got != tt.want {
+				t.Errorf("RefreshAfter(%v, %v) = %v, want %v", margin, tt.now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package iamcacheauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fileConfig is the JSON document read by [NewFromJSONFile].
+type fileConfig struct {
+	Service    string `json:"service"`    // "elasticache" or "memorydb"
+	User       string `json:"user"`       // IAM-enabled user ID
+	Resource   string `json:"resource"`   // cache or cluster name
+	Region     string `json:"region"`     // optional; overrides awsCfg.Region
+	Serverless bool   `json:"serverless"` // ElastiCache only
+	Expiry     string `json:"expiry"`     // optional Go duration, e.g. "10m"
+}
+
+// NewFromJSONFile creates a [TokenGenerator] from a JSON document at path,
+// for managing generator configuration declaratively. The document has the
+// form:
+//
+//	{
+//	  "service": "elasticache",
+//	  "user": "my-iam-user",
+//	  "resource": "my-cache",
+//	  "region": "us-east-1",
+//	  "serverless": false,
+//	  "expiry": "15m"
+//	}
+//
+// service, user and resource are required. region, when present, overrides
+// awsCfg.Region; expiry, when present, is a Go duration between 1s and 15m.
+// Unknown fields are rejected. Credentials always come from awsCfg, and the
+// same validation as [NewElastiCache] and [NewMemoryDB] applies, including
+// the rejection of serverless for MemoryDB.
+func NewFromJSONFile(path string, awsCfg aws.Config, opts ...Option) (*TokenGenerator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("iamcacheauth: failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("iamcacheauth: invalid config file %s: %w", path, err)
+	}
+
+	if fc.Region != "" {
+		awsCfg.Region = fc.Region
+	}
+
+	var fileOpts []Option
+	if fc.Serverless {
+		fileOpts = append(fileOpts, WithServerless())
+	}
+	if fc.Expiry != "" {
+		d, err := time.ParseDuration(fc.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("iamcacheauth: invalid expiry in config file %s: %w", path, err)
+		}
+		fileOpts = append(fileOpts, WithExpiry(d))
+	}
+	// Options from the file apply first so that explicit options win.
+	opts = append(fileOpts, opts...)
+
+	switch fc.Service {
+	case "elasticache":
+		return NewElastiCache(fc.User, fc.Resource, awsCfg, opts...)
+	case "memorydb":
+		return NewMemoryDB(fc.User, fc.Resource, awsCfg, opts...)
+	default:
+		return nil, fmt.Errorf("iamcacheauth: config file %s: unsupported service %q", path, fc.Service)
+	}
+}
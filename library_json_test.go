@@ -0,0 +1,97 @@
+package iamcacheauth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a temporary JSON file and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "iamcacheauth.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestNewFromJSONFile_ElastiCache(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"service": "elasticache",
+		"user": "my-user",
+		"resource": "my-cache",
+		"region": "ap-southeast-2",
+		"serverless": true,
+		"expiry": "10m"
+	}`)
+	gen, err := NewFromJSONFile(path, testAWSConfig("us-east-1"))
+	if err != nil {
+		t.Fatalf("NewFromJSONFile() unexpected error: %v", err)
+	}
+
+	vals := parseToken(t, differentialToken(t, gen))
+	if got := vals.Get("ResourceType"); got != "ServerlessCache" {
+		t.Errorf("ResourceType = %q, want %q", got, "ServerlessCache")
+	}
+	if got := vals.Get("X-Amz-Expires"); got != "600" {
+		t.Errorf("X-Amz-Expires = %q, want %q", got, "600")
+	}
+	scope := strings.Split(vals.Get("X-Amz-Credential"), "/")
+	if scope[2] != "ap-southeast-2" || scope[3] != "elasticache" {
+		t.Errorf("credential scope = %v, want ap-southeast-2/elasticache", scope)
+	}
+}
+
+func TestNewFromJSONFile_MemoryDB(t *testing.T) {
+	path := writeConfigFile(t, `{"service": "memorydb", "user": "my-user", "resource": "my-cluster"}`)
+	gen, err := NewFromJSONFile(path, testAWSConfig("us-east-1"))
+	if err != nil {
+		t.Fatalf("NewFromJSONFile() unexpected error: %v", err)
+	}
+	if gen.Service() != "memorydb" {
+		t.Errorf("Service() = %q, want %q", gen.Service(), "memorydb")
+	}
+	if gen.cfg.region != "us-east-1" {
+		t.Errorf("region = %q, want %q", gen.cfg.region, "us-east-1")
+	}
+	if gen.cfg.expiry != 15*time.Minute {
+		t.Errorf("expiry = %v, want %v", gen.cfg.expiry, 15*time.Minute)
+	}
+}
+
+func TestNewFromJSONFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"malformed", `{"service": `, "invalid config file"},
+		{"unknown field", `{"service": "elasticache", "user": "u", "resource": "r", "port": 6379}`, "unknown field"},
+		{"unknown service", `{"service": "dynamodb", "user": "u", "resource": "r"}`, "unsupported service"},
+		{"missing user", `{"service": "elasticache", "resource": "r"}`, "userID must not be empty"},
+		{"bad expiry", `{"service": "elasticache", "user": "u", "resource": "r", "expiry": "soon"}`, "invalid expiry"},
+		{"expiry too long", `{"service": "elasticache", "user": "u", "resource": "r", "expiry": "1h"}`, "expiry"},
+		{"memorydb serverless", `{"service": "memorydb", "user": "u", "resource": "r", "serverless": true}`, "serverless is not supported for MemoryDB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.content)
+			_, err := NewFromJSONFile(path, testAWSConfig("us-east-1"))
+			if err == nil {
+				t.Fatal("NewFromJSONFile() should return error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFromJSONFile_MissingFile(t *testing.T) {
+	if _, err := NewFromJSONFile(filepath.Join(t.TempDir(), "missing.json"), testAWSConfig("us-east-1")); err == nil {
+		t.Error("NewFromJSONFile() with missing file should return error")
+	}
+}
@@ -0,0 +1,175 @@
+package iamcacheauth
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Manager lazily constructs and keeps one [TokenGenerator] per distinct
+// configuration, all sharing one aws.Config and one credentials cache, for
+// processes that front many caches or clusters. It is safe for concurrent
+// use.
+//
+// Use [NewManager] to create instances.
+type Manager struct {
+	awsCfg aws.Config
+
+	mu   sync.Mutex
+	gens map[managerKey]*managerEntry
+}
+
+// managerKey identifies a generator by the configuration that shapes its
+// tokens and how it obtains them: the service, user and resource, and the
+// comparable fields that options set.
+type managerKey struct {
+	service, userID, name string
+
+	region, host, resourceType, path, method, action string
+	payloadHash                                      string
+	expiry                                           time.Duration
+	omitSecurityToken                                bool
+	maxTokenLength                                   int
+	skipUserValidation, skipResourceCheck            bool
+	retryAttempts                                    int
+	defaultTimeout                                   time.Duration
+	logger                                           *slog.Logger
+	fakeSigner                                       bool
+}
+
+// newManagerKey returns the key of the generator that cfg, with opts
+// applied, would build. It fails as construction would if an option does.
+//
+// shared is false if an option sets something that cannot be compared,
+// or that changes where credentials come from, so that two calls could
+// not be told apart: fixed or captured credentials, a credentials cache
+// configuration, a clock, a base context, a retry backoff, a resource
+// validator, a token wrapper or a callback.
+func newManagerKey(cfg tokenConfig, opts []Option) (key managerKey, shared bool, err error) {
+	cfg, err = applyOptions(cfg, opts)
+	if err != nil {
+		return managerKey{}, false, err
+	}
+	shared = cfg.credProvider == nil && cfg.captureCtx == nil && len(cfg.cacheOptions) == 0 &&
+		cfg.clock == nil && cfg.baseCtx == nil && cfg.retryBackoff == nil &&
+		cfg.resourceValidator == nil && cfg.tokenWrapper == nil &&
+		cfg.onToken == nil && cfg.onError == nil && cfg.onTokenCtx == nil && cfg.onErrorCtx == nil
+	return managerKey{
+		service:            cfg.serviceName,
+		userID:             cfg.userID,
+		name:               strings.ToLower(cfg.resourceName),
+		region:             cfg.region,
+		host:               strings.ToLower(signingHost(cfg)),
+		resourceType:       cfg.resourceType,
+		path:               cfg.path,
+		method:             cfg.method,
+		action:             cfg.action,
+		payloadHash:        string(cfg.payloadHash),
+		expiry:             cfg.expiry,
+		omitSecurityToken:  cfg.omitSecurityToken,
+		maxTokenLength:     cfg.maxTokenLength,
+		skipUserValidation: cfg.skipUserValidation,
+		skipResourceCheck:  cfg.skipResourceCheck,
+		retryAttempts:      cfg.retryAttempts,
+		defaultTimeout:     cfg.defaultTimeout,
+		logger:             cfg.logger,
+		fakeSigner:         cfg.fakeSigner,
+	}, shared, nil
+}
+
+// managerEntry is a generator under construction or built. ready is closed
+// once gen and err are set.
+type managerEntry struct {
+	ready chan struct{}
+	gen   *TokenGenerator
+	err   error
+}
+
+// NewManager creates a [Manager] whose generators are built from awsCfg.
+// A credentials provider that is not already an [aws.CredentialsCache] is
+// wrapped in one here, so every generator shares a single retrieval rather
+// than each caching the provider separately.
+func NewManager(awsCfg aws.Config) *Manager {
+	awsCfg.Credentials = cachedProvider(awsCfg.Credentials)
+	return &Manager{awsCfg: awsCfg, gens: map[managerKey]*managerEntry{}}
+}
+
+// ElastiCache returns the generator for userID, cacheName and opts,
+// creating it with [NewElastiCache] on first use. Calls whose options set
+// the same region, host, resource type, expiry, validation, retry and
+// logger share a generator; calls that differ in any of them get their
+// own.
+//
+// A call whose options cannot be compared with another's, or that change
+// where credentials come from, is built afresh every time and not kept:
+// [WithCredentials], [WithCaptureCredentials], [WithCredentialCache],
+// [WithClock], [WithBaseContext], [WithRetry] with a backoff,
+// [WithResourceValidator], [WithTokenWrapper] and the callback options.
+func (m *Manager) ElastiCache(userID, cacheName string, opts ...Option) (*TokenGenerator, error) {
+	return m.generator(tokenConfig{userID: userID, resourceName: cacheName, region: m.awsCfg.Region, serviceName: "elasticache"}, opts,
+		func() (*TokenGenerator, error) {
+			return NewElastiCache(userID, cacheName, m.awsCfg, opts...)
+		})
+}
+
+// MemoryDB returns the generator for userID, clusterName and opts,
+// creating it with [NewMemoryDB] on first use. Generators are shared as
+// for [Manager.ElastiCache].
+func (m *Manager) MemoryDB(userID, clusterName string, opts ...Option) (*TokenGenerator, error) {
+	return m.generator(tokenConfig{userID: userID, resourceName: clusterName, region: m.awsCfg.Region, serviceName: "memorydb"}, opts,
+		func() (*TokenGenerator, error) {
+			return NewMemoryDB(userID, clusterName, m.awsCfg, opts...)
+		})
+}
+
+// generator keys cfg with opts applied and returns the generator for that
+// key, building it with build if absent. A generator that cannot be shared
+// is built without being kept.
+func (m *Manager) generator(cfg tokenConfig, opts []Option, build func() (*TokenGenerator, error)) (*TokenGenerator, error) {
+	key, shared, err := newManagerKey(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !shared {
+		return build()
+	}
+	return m.get(key, build)
+}
+
+// Close forgets every generator, so later calls construct new ones.
+// Generators already returned keep working.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.gens)
+}
+
+// get returns the generator for key, building it with build if absent.
+// Concurrent calls for one key wait for a single build rather than holding
+// the lock through it, as a build may retrieve credentials. A failed build
+// is not kept, so a later call tries again.
+func (m *Manager) get(key managerKey, build func() (*TokenGenerator, error)) (*TokenGenerator, error) {
+	m.mu.Lock()
+	if e, ok := m.gens[key]; ok {
+		m.mu.Unlock()
+		<-e.ready
+		return e.gen, e.err
+	}
+	e := &managerEntry{ready: make(chan struct{})}
+	m.gens[key] = e
+	m.mu.Unlock()
+
+	e.gen, e.err = build()
+	if e.err != nil {
+		m.mu.Lock()
+		if m.gens[key] == e {
+			delete(m.gens, key)
+		}
+		m.mu.Unlock()
+	}
+	close(e.ready)
+	return e.gen, e.err
+}
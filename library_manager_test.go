@@ -0,0 +1,262 @@
+package iamcacheauth
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestManager_ReusesGenerators(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+
+	first, err := m.ElastiCache("my-user", "my-cache")
+	if err != nil {
+		t.Fatalf("ElastiCache() unexpected error: %v", err)
+	}
+	again, err := m.ElastiCache("my-user", "my-cache", WithExpiry(maxTokenExpiry))
+	if err != nil {
+		t.Fatalf("ElastiCache() unexpected error: %v", err)
+	}
+	if again != first {
+		t.Error("ElastiCache() for the same user, cache and effective options should return the same generator")
+	}
+
+	other, err := m.ElastiCache("other-user", "my-cache")
+	if err != nil {
+		t.Fatalf("ElastiCache() unexpected error: %v", err)
+	}
+	if other == first {
+		t.Error("ElastiCache() for a different user should return a different generator")
+	}
+
+	memorydb, err := m.MemoryDB("my-user", "my-cache")
+	if err != nil {
+		t.Fatalf("MemoryDB() unexpected error: %v", err)
+	}
+	if memorydb == first || memorydb.Service() != "memorydb" {
+		t.Error("MemoryDB() should not share a generator with ElastiCache()")
+	}
+}
+
+func TestManager_KeyedByOptions(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantRegion string
+	}{
+		{"eu-west-1", []Option{WithRegion("eu-west-1")}, "eu-west-1"},
+		{"ap-southeast-2", []Option{WithRegion("ap-southeast-2")}, "ap-southeast-2"},
+		{"serverless", []Option{WithServerless()}, "us-east-1"},
+		{"endpoint", []Option{WithEndpoint("my-cache.example.internal")}, "us-east-1"},
+		{"expiry", []Option{WithExpiry(5 * time.Minute)}, "us-east-1"},
+		{"default", nil, "us-east-1"},
+	}
+	seen := map[*TokenGenerator]string{}
+	for _, tt := range tests {
+		gen, err := m.ElastiCache("my-user", "my-cache", tt.opts...)
+		if err != nil {
+			t.Fatalf("ElastiCache(%s) unexpected error: %v", tt.name, err)
+		}
+		if gen.Region() != tt.wantRegion {
+			t.Errorf("ElastiCache(%s).Region() = %q, want %q", tt.name, gen.Region(), tt.wantRegion)
+		}
+		if prev, ok := seen[gen]; ok {
+			t.Errorf("ElastiCache(%s) returned the generator built for %s", tt.name, prev)
+		}
+		seen[gen] = tt.name
+
+		again, err := m.ElastiCache("my-user", "my-cache", tt.opts...)
+		if err != nil {
+			t.Fatalf("ElastiCache(%s) unexpected error: %v", tt.name, err)
+		}
+		if again != gen {
+			t.Errorf("ElastiCache(%s) a second time should return the same generator", tt.name)
+		}
+	}
+}
+
+func TestManager_SharesCredentialRetrieval(t *testing.T) {
+	creds := &countingCredentials{}
+	m := NewManager(aws.Config{Region: "us-east-1", Credentials: creds})
+	for _, name := range []string{"cache-a", "cache-b", "cache-c"} {
+		gen, err := m.ElastiCache("my-user", name)
+		if err != nil {
+			t.Fatalf("ElastiCache(%s) unexpected error: %v", name, err)
+		}
+		if _, err := gen.Token(context.Background()); err != nil {
+			t.Fatalf("Token() unexpected error: %v", err)
+		}
+	}
+	if got := creds.calls.Load(); got != 1 {
+		t.Errorf("Retrieve called %d times for 3 generators, want 1", got)
+	}
+}
+
+func TestManager_Concurrent(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	gens := make([]*TokenGenerator, 50)
+	var wg sync.WaitGroup
+	for i := range gens {
+		wg.Go(func() {
+			gen, err := m.ElastiCache("my-user", "my-cache")
+			if err != nil {
+				t.Errorf("ElastiCache() unexpected error: %v", err)
+			}
+			gens[i] = gen
+		})
+	}
+	wg.Wait()
+	for i, gen := range gens {
+		if gen != gens[0] {
+			t.Fatalf("generator %d differs; concurrent calls should share one generator", i)
+		}
+	}
+}
+
+func TestManager_FailedBuildNotKept(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	// The options are valid, so the key is built and an entry added; the
+	// user ID fails validation inside the build.
+	if _, err := m.ElastiCache("1user", "my-cache"); err == nil {
+		t.Fatal("ElastiCache() with an invalid user ID should return error")
+	}
+	if n := len(m.gens); n != 0 {
+		t.Errorf("manager holds %d entries after a failed build, want 0", n)
+	}
+	if _, err := m.ElastiCache("1user", "my-cache", WithSkipUserValidation()); err != nil {
+		t.Errorf("ElastiCache() after a failed build unexpected error: %v", err)
+	}
+}
+
+func TestManager_CredentialOptionsNotShared(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	credsA := aws.Credentials{AccessKeyID: "AKIDAAAAAAAAAAAAAAAA", SecretAccessKey: "secret-a"}
+	credsB := aws.Credentials{AccessKeyID: "AKIDBBBBBBBBBBBBBBBB", SecretAccessKey: "secret-b"}
+	genA, err := m.ElastiCache("my-user", "my-cache", WithCredentials(credsA))
+	if err != nil {
+		t.Fatalf("ElastiCache(WithCredentials(A)) unexpected error: %v", err)
+	}
+	genB, err := m.ElastiCache("my-user", "my-cache", WithCredentials(credsB))
+	if err != nil {
+		t.Fatalf("ElastiCache(WithCredentials(B)) unexpected error: %v", err)
+	}
+	if genA == genB {
+		t.Fatal("calls with different WithCredentials should not share a generator")
+	}
+	token, err := genB.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if !strings.Contains(token, credsB.AccessKeyID) {
+		t.Errorf("token %q should be signed with the second caller's credentials", token)
+	}
+}
+
+func TestManager_UncomparableOptionsNotShared(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  func() Option
+	}{
+		{"WithCredentials", func() Option {
+			return WithCredentials(aws.Credentials{AccessKeyID: "AKIDAAAAAAAAAAAAAAAA", SecretAccessKey: "secret"})
+		}},
+		{"WithCaptureCredentials", func() Option { return WithCaptureCredentials(context.Background()) }},
+		{"WithCredentialCache", func() Option {
+			return WithCredentialCache(func(o *aws.CredentialsCacheOptions) { o.ExpiryWindow = time.Minute })
+		}},
+		{"WithClock", func() Option { return WithClock(time.Now) }},
+		{"WithBaseContext", func() Option { return WithBaseContext(context.Background()) }},
+		{"WithRetry backoff", func() Option { return WithRetry(2, func(int) time.Duration { return 0 }) }},
+		{"WithResourceValidator", func() Option { return WithResourceValidator(func(string) error { return nil }) }},
+		{"WithTokenWrapper", func() Option { return WithTokenWrapper(Base64Wrapper) }},
+		{"WithOnTokenGenerated", func() Option { return WithOnTokenGenerated(func(string, time.Time) {}) }},
+		{"WithOnError", func() Option { return WithOnError(func(error) {}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(testAWSConfig("us-east-1"))
+			first, err := m.ElastiCache("my-user", "my-cache", tt.opt())
+			if err != nil {
+				t.Fatalf("ElastiCache() unexpected error: %v", err)
+			}
+			second, err := m.ElastiCache("my-user", "my-cache", tt.opt())
+			if err != nil {
+				t.Fatalf("ElastiCache() unexpected error: %v", err)
+			}
+			plain, err := m.ElastiCache("my-user", "my-cache")
+			if err != nil {
+				t.Fatalf("ElastiCache() unexpected error: %v", err)
+			}
+			if first == second || first == plain {
+				t.Errorf("a call with %s should get its own generator", tt.name)
+			}
+		})
+	}
+}
+
+func TestManager_ValidationOptionsKeyed(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	if _, err := m.ElastiCache("my-user", "my_cache", WithSkipResourceValidation()); err != nil {
+		t.Fatalf("ElastiCache(WithSkipResourceValidation) unexpected error: %v", err)
+	}
+	if _, err := m.ElastiCache("my-user", "my_cache"); err == nil {
+		t.Error("ElastiCache() without WithSkipResourceValidation should reject a name its construction rejects")
+	}
+	if _, err := m.ElastiCache("1user", "my-cache", WithSkipUserValidation()); err != nil {
+		t.Fatalf("ElastiCache(WithSkipUserValidation) unexpected error: %v", err)
+	}
+	if _, err := m.ElastiCache("1user", "my-cache"); err == nil {
+		t.Error("ElastiCache() without WithSkipUserValidation should reject a user ID its construction rejects")
+	}
+}
+
+func TestManager_ComparableOptionsKeyed(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	logger := slog.New(slog.DiscardHandler)
+	for _, opts := range [][]Option{
+		{WithRetry(3, nil)},
+		{WithDefaultTimeout(time.Second)},
+		{WithLogger(logger)},
+	} {
+		first, err := m.ElastiCache("my-user", "my-cache", opts...)
+		if err != nil {
+			t.Fatalf("ElastiCache() unexpected error: %v", err)
+		}
+		again, err := m.ElastiCache("my-user", "my-cache", opts...)
+		if err != nil {
+			t.Fatalf("ElastiCache() unexpected error: %v", err)
+		}
+		plain, err := m.ElastiCache("my-user", "my-cache")
+		if err != nil {
+			t.Fatalf("ElastiCache() unexpected error: %v", err)
+		}
+		if first != again {
+			t.Error("equal comparable options should share a generator")
+		}
+		if first == plain {
+			t.Error("a comparable option should be part of the key")
+		}
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	m := NewManager(testAWSConfig("us-east-1"))
+	first, err := m.ElastiCache("my-user", "my-cache")
+	if err != nil {
+		t.Fatalf("ElastiCache() unexpected error: %v", err)
+	}
+	m.Close()
+	second, err := m.ElastiCache("my-user", "my-cache")
+	if err != nil {
+		t.Fatalf("ElastiCache() unexpected error: %v", err)
+	}
+	if second == first {
+		t.Error("ElastiCache() after Close() should construct a new generator")
+	}
+}
@@ -0,0 +1,102 @@
+package iamcacheauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// redactedSignature replaces X-Amz-Signature in tokens passed to [Redact].
+const redactedSignature = "REDACTED"
+
+// String describes the generator by service, region, resource and user, so
+// a generator that ends up in a log line or error message shows which cache
+// it targets. It never includes credentials or anything derived from them.
+func (g *TokenGenerator) String() string {
+	serverless := ""
+	if g.IsServerless() {
+		serverless = " serverless"
+	}
+	return fmt.Sprintf("iamcacheauth.TokenGenerator{%s/%s resource=%s user=%s%s}",
+		g.cfg.serviceName, g.cfg.region, g.cfg.resourceName, g.cfg.userID, serverless)
+}
+
+// GoString is [TokenGenerator.String], so that %#v does not print the
+// generator's fields, which include its credentials provider.
+func (g *TokenGenerator) GoString() string {
+	return g.String()
+}
+
+// Redact returns token in a form that is safe to log: the X-Amz-Signature
+// value is replaced with "REDACTED" and X-Amz-Security-Token is removed.
+// The host, user, credential scope, date and expiry are kept as they are,
+// so the redacted token still shows what it was for and when it was
+// signed. Other parameters keep their order and their original escaping.
+//
+// Anything that does not read as a presigned query string with an
+// X-Amz-Signature, including a token transformed by [WithTokenWrapper]
+// such as [Base64Wrapper], is replaced by "REDACTED" as a whole, since its
+// secrets cannot be located to remove them.
+func Redact(token string) string {
+	redacted, ok := redactQuery(token)
+	if !ok {
+		return redactedSignature
+	}
+	return redacted
+}
+
+// redactQuery is [Redact] for a raw token. It reports false if token has
+// no query string or no X-Amz-Signature.
+func redactQuery(token string) (string, bool) {
+	host, query, ok := strings.Cut(token, "?")
+	if !ok {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.Grow(len(token))
+	b.WriteString(host)
+	b.WriteByte('?')
+	first, signed := true, false
+	for param := range strings.SplitSeq(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		switch name {
+		case "X-Amz-Security-Token":
+			continue
+		case "X-Amz-Signature":
+			param = name + "=" + redactedSignature
+			signed = true
+		}
+		if !first {
+			b.WriteByte('&')
+		}
+		first = false
+		b.WriteString(param)
+	}
+	if !signed {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// Fingerprint returns a short identifier for token, for correlating log
+// lines about the same token without logging the token. It is the first 8
+// bytes, in hex, of a SHA-256 hash of [Redact] applied to token, so it
+// covers the host, user, credential scope, X-Amz-Date and expiry but not
+// the signature or session token: tokens signed for the same request in
+// the same second share a fingerprint, and a signature change alone does
+// not alter it. Input that Redact would replace whole, such as a wrapped
+// token, is hashed as it is, so distinct wrapped tokens still get distinct
+// fingerprints.
+//
+// Fingerprint is for observability, not security. It is short enough that
+// collisions are possible and must not be used to authenticate or
+// deduplicate tokens.
+func Fingerprint(token string) string {
+	if redacted, ok := redactQuery(token); ok {
+		token = redacted
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
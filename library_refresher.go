@@ -0,0 +1,203 @@
+package iamcacheauth
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// refreshJitter is the largest fraction of the refresh interval by
+	// which a [Refresher] mints early, so that many refreshers started
+	// together do not all mint at the same moment.
+	refreshJitter = 0.1
+
+	// refreshRetryDelay is how long a [Refresher] waits after a failed
+	// mint before trying again.
+	refreshRetryDelay = 5 * time.Second
+
+	// minRefreshInterval bounds how often a [Refresher] mints, even if a
+	// token is already due for refresh when it is minted.
+	minRefreshInterval = time.Second
+)
+
+// Refresher mints a fresh token shortly before the current one expires and
+// delivers it on a channel, for connection supervisors that
+// re-authenticate long-lived connections proactively.
+//
+// Refreshes are scheduled from each token's expiry as read from the
+// generator's clock, and timed with real timers. Under a [WithClock] clock
+// that does not advance, every refresh therefore comes at the usual
+// interval and delivers a token identical to the previous one; consumers
+// must not assume consecutive tokens differ.
+//
+// Use [NewRefresher] to create instances.
+type Refresher struct {
+	gen    *TokenGenerator
+	margin time.Duration
+	notify chan struct{} // buffered; a pending notification fills it
+
+	// observe, if set, is called by run with each token it mints, before
+	// the token is delivered. It is set only before Start.
+	observe func(token string, info TokenInfo)
+
+	mu     sync.Mutex
+	tokens chan string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRefresher creates a [Refresher] that mints a new token margin before
+// the previous one expires, less up to 10% jitter. A zero margin means 60
+// seconds. The margin must be shorter than the token lifetime.
+func NewRefresher(gen *TokenGenerator, margin time.Duration) (*Refresher, error) {
+	if gen == nil {
+		return nil, fmt.Errorf("iamcacheauth: generator must not be nil")
+	}
+	if margin == 0 {
+		margin = defaultRefreshMargin
+	}
+	if margin < 0 || margin >= gen.cfg.expiry {
+		return nil, fmt.Errorf("iamcacheauth: refresh margin %v must be between 0 and the token expiry %v", margin, gen.cfg.expiry)
+	}
+	return &Refresher{gen: gen, margin: margin, notify: make(chan struct{}, 1)}, nil
+}
+
+// Start mints a token immediately and then before each expiry, delivering
+// each on the returned channel until ctx is cancelled or [Refresher.Stop]
+// is called, when the channel is closed. ctx also bounds each credential
+// retrieval.
+//
+// The channel holds only the latest token: one not yet received when the
+// next is minted is replaced, so a slow reader never sees a stale token. A
+// failed mint is retried after a short delay and is not reported; the
+// previous token stays usable until it expires.
+//
+// Calling Start again returns the same channel.
+func (r *Refresher) Start(ctx context.Context) <-chan string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokens == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		r.tokens = make(chan string, 1)
+		r.cancel = cancel
+		r.done = make(chan struct{})
+		go r.run(ctx)
+	}
+	return r.tokens
+}
+
+// Stop ends refreshing and waits for the refresher's goroutine to exit, so
+// the channel is closed when it returns. It is safe to call more than
+// once, and does nothing if Start was not called.
+func (r *Refresher) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Notify makes the refresher mint a new token now rather than at the next
+// scheduled refresh, for credential rotation it cannot see for itself,
+// such as Kubernetes replacing an IRSA web identity token file. Call it
+// from a filesystem watch or similar event:
+//
+//	// on each write to $AWS_WEB_IDENTITY_TOKEN_FILE
+//	r.Notify()
+//
+// If the generator's credentials are held in an [aws.CredentialsCache],
+// the cache is invalidated first, so the new token is signed with freshly
+// retrieved credentials. Credentials captured with
+// [WithCaptureCredentials] are kept. Notifications that arrive before the
+// refresher acts on an earlier one are merged into it, and the regular
+// schedule resumes from the new token. Notify never blocks and does
+// nothing once the refresher has stopped.
+func (r *Refresher) Notify() {
+	if cache, ok := r.gen.cfg.credProvider.(*aws.CredentialsCache); ok {
+		cache.Invalidate()
+	}
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Refresher) run(ctx context.Context) {
+	defer close(r.done)
+	defer close(r.tokens)
+
+	for {
+		wait := refreshRetryDelay
+		token, info, err := r.gen.TokenAndInfo(ctx)
+		if err == nil {
+			if r.observe != nil {
+				r.observe(token, info)
+			}
+			r.deliver(token)
+			wait = jitter(info.RefreshAfter(r.margin, r.gen.cfg.clock()))
+		}
+
+		timer := time.NewTimer(max(wait, minRefreshInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliver replaces any unreceived token with token. run is the only
+// sender, so once the buffer is drained the send cannot block.
+func (r *Refresher) deliver(token string) {
+	select {
+	case <-r.tokens:
+	default:
+	}
+	r.tokens <- token
+}
+
+// jitter shortens d by a random amount of up to refreshJitter of d.
+func jitter(d time.Duration) time.Duration {
+	return d - rand.N(time.Duration(float64(d)*refreshJitter)+1)
+}
+
+// Tokens returns a sequence that yields a freshly minted token immediately
+// and then once per every, as a range-over-func alternative to
+// [Refresher]. It ends when ctx is done or the loop body breaks. A failed
+// mint yields its error, and the sequence continues if the loop does; a
+// non-positive every yields a single error.
+func (g *TokenGenerator) Tokens(ctx context.Context, every time.Duration) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		if every <= 0 {
+			yield("", fmt.Errorf("iamcacheauth: token interval must be positive, got %v", every))
+			return
+		}
+
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			if !yield(g.Token(ctx)) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
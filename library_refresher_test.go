@@ -0,0 +1,346 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestRefresher_MintsBeforeExpiry(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		gen := newElastiCacheGenerator(t)
+		r, err := NewRefresher(gen, time.Minute)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		defer r.Stop()
+
+		start := time.Now()
+		tokens := r.Start(context.Background())
+		first := <-tokens
+		if !time.Now().Equal(start) {
+			t.Errorf("first token delivered after %v, want immediately", time.Since(start))
+		}
+
+		second := <-tokens
+		// Due 14m after signing, less up to 10% jitter.
+		if elapsed := time.Since(start); elapsed > 14*time.Minute || elapsed < 14*time.Minute*9/10 {
+			t.Errorf("second token delivered after %v, want between 12m36s and 14m", elapsed)
+		}
+		if second == first {
+			t.Error("second token should be freshly minted")
+		}
+	})
+}
+
+func TestRefresher_KeepsOnlyLatest(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		gen := newElastiCacheGenerator(t)
+		r, err := NewRefresher(gen, 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		defer r.Stop()
+
+		tokens := r.Start(context.Background())
+		// Let several refreshes pass without receiving.
+		time.Sleep(45 * time.Minute)
+		synctest.Wait()
+
+		latest := <-tokens
+		res, err := ParseToken(latest)
+		if err != nil {
+			t.Fatalf("ParseToken() unexpected error: %v", err)
+		}
+		if age := time.Since(res.SignedAt); age > 15*time.Minute {
+			t.Errorf("received token signed %v ago, want the latest token", age)
+		}
+		select {
+		case token := <-tokens:
+			t.Errorf("channel held a second token %q, want only the latest", token)
+		default:
+		}
+	})
+}
+
+func TestRefresher_StopClosesChannel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r, err := NewRefresher(newElastiCacheGenerator(t), 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		tokens := r.Start(context.Background())
+		if again := r.Start(context.Background()); again != tokens {
+			t.Error("Start() called twice should return the same channel")
+		}
+		<-tokens
+
+		r.Stop()
+		if _, ok := <-tokens; ok {
+			t.Error("channel should be closed after Stop()")
+		}
+		r.Stop()
+	})
+}
+
+func TestRefresher_ContextCancelClosesChannel(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r, err := NewRefresher(newElastiCacheGenerator(t), 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		tokens := r.Start(ctx)
+		<-tokens
+
+		cancel()
+		if _, ok := <-tokens; ok {
+			t.Error("channel should be closed after the context is cancelled")
+		}
+	})
+}
+
+func TestRefresher_RetriesFailedMint(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// The token length limit makes every mint fail after signing;
+		// the wrapper counts the attempts.
+		var attempts atomic.Int32
+		gen := newElastiCacheGenerator(t, WithMaxTokenLength(1), WithTokenWrapper(func(raw string) string {
+			attempts.Add(1)
+			return raw
+		}))
+		r, err := NewRefresher(gen, 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		tokens := r.Start(context.Background())
+
+		// Every mint fails, so nothing is delivered, but the refresher
+		// keeps trying at the retry delay until stopped.
+		time.Sleep(3*refreshRetryDelay + time.Millisecond)
+		synctest.Wait()
+		select {
+		case token := <-tokens:
+			t.Errorf("failed mints should deliver nothing, got %q", token)
+		default:
+		}
+		if got := attempts.Load(); got != 4 {
+			t.Errorf("mint attempts = %d, want 4", got)
+		}
+		r.Stop()
+		if _, ok := <-tokens; ok {
+			t.Error("channel should be closed after Stop()")
+		}
+	})
+}
+
+// rotatingCredentials is a test helper returning non-expiring credentials
+// whose access key can be changed, standing in for a provider whose source
+// (such as a web identity token file) is rotated underneath it.
+type rotatingCredentials struct {
+	key atomic.Value // string
+}
+
+func (c *rotatingCredentials) Retrieve(context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: c.key.Load().(string), SecretAccessKey: "secret"}, nil
+}
+
+func TestRefresher_NotifyRefreshesEarly(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		creds := &rotatingCredentials{}
+		creds.key.Store("AKIAFIRSTKEYEXAMPLE")
+		gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds})
+		if err != nil {
+			t.Fatalf("NewElastiCache() unexpected error: %v", err)
+		}
+		r, err := NewRefresher(gen, 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		defer r.Stop()
+
+		tokens := r.Start(context.Background())
+		if first := <-tokens; !strings.Contains(first, "X-Amz-Credential=AKIAFIRSTKEYEXAMPLE") {
+			t.Fatalf("first token %q should be signed with the first key", first)
+		}
+
+		// The credentials never expire, so without a notification the
+		// cache would keep the first key until the next scheduled mint.
+		time.Sleep(time.Minute)
+		creds.key.Store("AKIAROTATEDKEYEXAMPLE")
+		notified := time.Now()
+		r.Notify()
+
+		rotated := <-tokens
+		if !time.Now().Equal(notified) {
+			t.Errorf("rotated token delivered %v after Notify(), want immediately", time.Since(notified))
+		}
+		if !strings.Contains(rotated, "X-Amz-Credential=AKIAROTATEDKEYEXAMPLE") {
+			t.Errorf("token after Notify() %q should be signed with the rotated key", rotated)
+		}
+
+		// The regular schedule resumes from the rotated token.
+		<-tokens
+		if elapsed := time.Since(notified); elapsed > 14*time.Minute || elapsed < 14*time.Minute*9/10 {
+			t.Errorf("next scheduled token delivered %v after the rotation, want between 12m36s and 14m", elapsed)
+		}
+	})
+}
+
+func TestRefresher_NotifyBeforeStartAndAfterStop(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		r, err := NewRefresher(newElastiCacheGenerator(t), 0)
+		if err != nil {
+			t.Fatalf("NewRefresher() unexpected error: %v", err)
+		}
+		r.Notify()
+		tokens := r.Start(context.Background())
+		<-tokens
+		r.Stop()
+		r.Notify()
+		r.Notify()
+	})
+}
+
+func TestRefresher_FixedClock(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		fixed := differentialTime
+		var mints atomic.Int32
+		gen := newElastiCacheGenerator(t, WithClock(func() time.Time { return fixed }),
+			WithOnTokenGenerated(func(string, time.Time) { mints.Add(1) }))
+		rot, err := NewRotator(context.Background(), gen, time.Minute)
+		if err != nil {
+			t.Fatalf("NewRotator() unexpected error: %v", err)
+		}
+		defer rot.Stop()
+		synctest.Wait()
+		_, first := rot.Credentials()
+
+		// The clock never moves, so each token expires 15 minutes after
+		// the same instant; refreshes still come every 14 minutes less
+		// jitter of real time rather than in a tight loop.
+		time.Sleep(45 * time.Minute)
+		synctest.Wait()
+		if got := mints.Load(); got != 4 {
+			t.Errorf("minted %d tokens in 45 minutes under a fixed clock, want 4", got)
+		}
+
+		_, latest := rot.Credentials()
+		if latest != first {
+			t.Errorf("Credentials() = %q, want the same token %q under a fixed clock", latest, first)
+		}
+		res, err := ParseToken(latest)
+		if err != nil {
+			t.Fatalf("ParseToken() unexpected error: %v", err)
+		}
+		if !res.SignedAt.Equal(fixed) {
+			t.Errorf("SignedAt = %v, want the fixed clock time %v", res.SignedAt, fixed)
+		}
+	})
+}
+
+func TestNewRefresher_Validation(t *testing.T) {
+	gen := newElastiCacheGenerator(t)
+	if _, err := NewRefresher(nil, 0); err == nil {
+		t.Error("NewRefresher(nil) should return error")
+	}
+	for _, margin := range []time.Duration{-time.Second, 15 * time.Minute, time.Hour} {
+		if _, err := NewRefresher(gen, margin); err == nil {
+			t.Errorf("NewRefresher() with margin %v should return error", margin)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	d := 10 * time.Minute
+	for range 100 {
+		if got := jitter(d); got > d || got < d*9/10 {
+			t.Fatalf("jitter(%v) = %v, want between %v and %v", d, got, d*9/10, d)
+		}
+	}
+	if got := jitter(0); got != 0 {
+		t.Errorf("jitter(0) = %v, want 0", got)
+	}
+}
+
+func TestTokens_YieldsEachInterval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		gen := newElastiCacheGenerator(t)
+		start := time.Now()
+		var tokens []string
+		for token, err := range gen.Tokens(context.Background(), time.Minute) {
+			if err != nil {
+				t.Fatalf("Tokens() yielded error: %v", err)
+			}
+			if want := time.Duration(len(tokens)) * time.Minute; time.Since(start) != want {
+				t.Errorf("token %d yielded after %v, want %v", len(tokens), time.Since(start), want)
+			}
+			tokens = append(tokens, token)
+			if len(tokens) == 3 {
+				break
+			}
+		}
+		if tokens[0] == tokens[1] || tokens[1] == tokens[2] {
+			t.Error("each yielded token should be freshly minted")
+		}
+	})
+}
+
+func TestTokens_StopsWhenContextDone(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Second)
+		defer cancel()
+		n := 0
+		for _, err := range newElastiCacheGenerator(t).Tokens(ctx, time.Minute) {
+			if err != nil {
+				t.Fatalf("Tokens() yielded error: %v", err)
+			}
+			n++
+		}
+		if n != 3 {
+			t.Errorf("Tokens() yielded %d tokens before the deadline, want 3", n)
+		}
+	})
+}
+
+func TestTokens_YieldsErrors(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		sentinel := errors.New("cred boom")
+		gen, err := NewElastiCache("my-user", "my-cache", aws.Config{
+			Region:      "us-east-1",
+			Credentials: failingCredentials{err: sentinel},
+		})
+		if err != nil {
+			t.Fatalf("NewElastiCache() unexpected error: %v", err)
+		}
+		n := 0
+		for token, err := range gen.Tokens(context.Background(), time.Minute) {
+			if token != "" || !errors.Is(err, sentinel) {
+				t.Errorf("Tokens() yielded %q, %v; want the credential error", token, err)
+			}
+			// The consumer chooses to keep going after an error.
+			if n++; n == 2 {
+				break
+			}
+		}
+	})
+}
+
+func TestTokens_NonPositiveInterval(t *testing.T) {
+	n := 0
+	for _, err := range newElastiCacheGenerator(t).Tokens(context.Background(), 0) {
+		if err == nil {
+			t.Error("Tokens() with a zero interval should yield an error")
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Tokens() with a zero interval yielded %d values, want 1", n)
+	}
+}
@@ -0,0 +1,114 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedToken is returned, wrapped with detail, by [ParseToken] when
+// a token does not have the structure of a presigned connect token.
+var ErrMalformedToken = errors.New("iamcacheauth: malformed token")
+
+// TokenResult is a token together with its main fields, for callers that
+// would otherwise parse the query string back out of it.
+type TokenResult struct {
+	Raw       string        // the token, exactly as Token returns it
+	Host      string        // signed host
+	User      string        // User query parameter
+	Action    string        // Action query parameter, "connect" unless set by WithAction
+	ExpiresIn time.Duration // X-Amz-Expires
+	SignedAt  time.Time     // X-Amz-Date, UTC, whole seconds
+}
+
+// TokenDetailed generates a fresh token like [TokenGenerator.Token] and
+// returns it as a [TokenResult]. The fields are populated from the signing
+// inputs rather than by parsing the token.
+func (g *TokenGenerator) TokenDetailed(ctx context.Context) (TokenResult, error) {
+	creds, err := g.retrieveCredentials(ctx)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	now := g.cfg.clock()
+	in := g.input(creds, g.signingHost())
+	token, err := g.sign(ctx, in, now)
+	if err != nil {
+		return TokenResult{}, err
+	}
+
+	return TokenResult{
+		Raw:       token,
+		Host:      in.host,
+		User:      in.user,
+		Action:    g.cfg.action,
+		ExpiresIn: g.cfg.expiry,
+		SignedAt:  g.info(in, now).IssuedAt,
+	}, nil
+}
+
+// ParseToken decodes a token into a [TokenResult], for inspecting tokens
+// received from elsewhere. It checks structure only: the host, the query
+// string and the X-Amz-Date and X-Amz-Expires values must parse, but the
+// signature is not verified.
+func ParseToken(token string) (TokenResult, error) {
+	prefix, rawQuery, ok := strings.Cut(token, "?")
+	if !ok {
+		return TokenResult{}, fmt.Errorf("%w: no query string", ErrMalformedToken)
+	}
+	host, _, _ := strings.Cut(prefix, "/")
+	if host == "" {
+		return TokenResult{}, fmt.Errorf("%w: no host", ErrMalformedToken)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return TokenResult{}, fmt.Errorf("%w: %w", ErrMalformedToken, err)
+	}
+
+	signedAt, err := time.Parse(sigv4TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return TokenResult{}, fmt.Errorf("%w: X-Amz-Date %q is not a SigV4 timestamp", ErrMalformedToken, query.Get("X-Amz-Date"))
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 {
+		return TokenResult{}, fmt.Errorf("%w: X-Amz-Expires %q is not a number of seconds", ErrMalformedToken, query.Get("X-Amz-Expires"))
+	}
+
+	return TokenResult{
+		Raw:       token,
+		Host:      host,
+		User:      query.Get("User"),
+		Action:    query.Get("Action"),
+		ExpiresIn: time.Duration(expires) * time.Second,
+		SignedAt:  signedAt,
+	}, nil
+}
+
+// IsExpired reports whether token has expired at now, judged from its
+// X-Amz-Date and X-Amz-Expires, for deciding whether a token received from
+// elsewhere can still open a connection. A token is expired from the
+// instant its validity ends, as the service judges it. The token is parsed
+// with [ParseToken], so one missing either value, or otherwise malformed,
+// returns an error matching [ErrMalformedToken].
+func IsExpired(token string, now time.Time) (bool, error) {
+	remaining, err := TimeUntilExpiry(token, now)
+	if err != nil {
+		return false, err
+	}
+	return remaining == 0, nil
+}
+
+// TimeUntilExpiry returns how long after now token expires, for scheduling
+// its replacement; subtract a margin to refresh ahead of expiry. It is zero
+// if the token has already expired. Errors are as for [IsExpired].
+func TimeUntilExpiry(token string, now time.Time) (time.Duration, error) {
+	res, err := ParseToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return max(res.SignedAt.Add(res.ExpiresIn).Sub(now), 0), nil
+}
@@ -0,0 +1,147 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestTokenDetailed_MatchesToken(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		time.Sleep(1500 * time.Millisecond)
+
+		gen := newElastiCacheGenerator(t, WithExpiry(10*time.Minute))
+		token, err := gen.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token() unexpected error: %v", err)
+		}
+		res, err := gen.TokenDetailed(context.Background())
+		if err != nil {
+			t.Fatalf("TokenDetailed() unexpected error: %v", err)
+		}
+
+		if res.Raw != token {
+			t.Errorf("Raw = %q, want %q", res.Raw, token)
+		}
+		vals := parseToken(t, token)
+		signedAt, err := time.Parse("20060102T150405Z", vals.Get("X-Amz-Date"))
+		if err != nil {
+			t.Fatalf("failed to parse X-Amz-Date: %v", err)
+		}
+		want := TokenResult{
+			Raw:       token,
+			Host:      "my-cache",
+			User:      vals.Get("User"),
+			Action:    vals.Get("Action"),
+			ExpiresIn: 10 * time.Minute,
+			SignedAt:  signedAt,
+		}
+		if res != want {
+			t.Errorf("TokenDetailed() = %+v, want %+v", res, want)
+		}
+	})
+}
+
+func TestParseToken_RoundTrip(t *testing.T) {
+	gen := newElastiCacheGenerator(t, WithPath("/custom"), WithAction("migrate"))
+	want, err := gen.TokenDetailed(context.Background())
+	if err != nil {
+		t.Fatalf("TokenDetailed() unexpected error: %v", err)
+	}
+	got, err := ParseToken(want.Raw)
+	if err != nil {
+		t.Fatalf("ParseToken() unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("ParseToken() = %+v, want %+v", got, want)
+	}
+	if got.Action != "migrate" {
+		t.Errorf("Action = %q, want %q", got.Action, "migrate")
+	}
+}
+
+func TestParseToken_Malformed(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"my-cache/",
+		"/?Action=connect&X-Amz-Date=20240301T123045Z&X-Amz-Expires=900",
+		"my-cache/?Action=connect&X-Amz-Date=20240301T123045Z&X-Amz-Expires=900&bad=%zz",
+		"my-cache/?Action=connect&X-Amz-Expires=900",
+		"my-cache/?Action=connect&X-Amz-Date=yesterday&X-Amz-Expires=900",
+		"my-cache/?Action=connect&X-Amz-Date=20240301T123045Z",
+		"my-cache/?Action=connect&X-Amz-Date=20240301T123045Z&X-Amz-Expires=-1",
+	} {
+		if _, err := ParseToken(token); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("ParseToken(%q) error = %v, want ErrMalformedToken", token, err)
+		}
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	const token = "my-cache/?Action=connect&User=my-user&X-Amz-Date=20240301T123045Z&X-Amz-Expires=900"
+	signedAt := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	tests := []struct {
+		name          string
+		now           time.Time
+		wantExpired   bool
+		wantRemaining time.Duration
+	}{
+		{"just signed", signedAt, false, 15 * time.Minute},
+		{"halfway", signedAt.Add(450 * time.Second), false, 450 * time.Second},
+		{"last instant", signedAt.Add(15*time.Minute - time.Nanosecond), false, time.Nanosecond},
+		{"at expiry", signedAt.Add(15 * time.Minute), true, 0},
+		{"long expired", signedAt.Add(time.Hour), true, 0},
+		{"other zone", signedAt.In(time.FixedZone("AEST", 10*60*60)).Add(time.Minute), false, 14 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired, err := IsExpired(token, tt.now)
+			if err != nil {
+				t.Fatalf("IsExpired() unexpected error: %v", err)
+			}
+			if expired != tt.wantExpired {
+				t.Errorf("IsExpired() = %v, want %v", expired, tt.wantExpired)
+			}
+			remaining, err := TimeUntilExpiry(token, tt.now)
+			if err != nil {
+				t.Fatalf("TimeUntilExpiry() unexpected error: %v", err)
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("TimeUntilExpiry() = %v, want %v", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestIsExpired_GeneratedToken(t *testing.T) {
+	gen := newElastiCacheGenerator(t, WithClock(func() time.Time { return differentialTime }), WithExpiry(5*time.Minute))
+	token, err := gen.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if remaining, err := TimeUntilExpiry(token, differentialTime); err != nil || remaining != 5*time.Minute {
+		t.Errorf("TimeUntilExpiry() = %v, %v, want 5m", remaining, err)
+	}
+	if expired, err := IsExpired(token, differentialTime.Add(5*time.Minute)); err != nil || !expired {
+		t.Errorf("IsExpired() after 5m = %v, %v, want true", expired, err)
+	}
+}
+
+func TestIsExpired_Malformed(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	for _, token := range []string{
+		"my-cache/?Action=connect&X-Amz-Expires=900",
+		"my-cache/?Action=connect&X-Amz-Date=20240301T123045Z",
+		"my-cache/?Action=connect&X-Amz-Date=yesterday&X-Amz-Expires=900",
+		"my-cache/?Action=connect&X-Amz-Date=20240301T123045Z&X-Amz-Expires=soon",
+	} {
+		if _, err := IsExpired(token, now); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("IsExpired(%q) error = %v, want ErrMalformedToken", token, err)
+		}
+		if _, err := TimeUntilExpiry(token, now); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("TimeUntilExpiry(%q) error = %v, want ErrMalformedToken", token, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package iamcacheauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// WithRetry makes the generator try credential retrieval up to attempts
+// times in all before failing, waiting backoff(n) after the nth failed
+// attempt. A nil backoff retries at once. Signing is deterministic and is
+// never retried, nor are expired credentials, which a retry would return
+// again.
+//
+// Retries stop early once ctx is done or its deadline would pass during the
+// wait. The error returned then, or after the last attempt, wraps the last
+// retrieval failure. By default retrieval is tried once.
+func WithRetry(attempts int, backoff func(attempt int) time.Duration) Option {
+	return func(cfg *tokenConfig) error {
+		if attempts < 1 {
+			return fmt.Errorf("iamcacheauth: retry attempts must be at least 1, got %d", attempts)
+		}
+		cfg.retryAttempts = attempts
+		cfg.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithDefaultTimeout bounds credential retrieval by d when the context
+// passed to Token has no deadline, so a hung provider, such as one waiting
+// on an unreachable IMDS, cannot block forever under context.Background.
+// The bound covers every [WithRetry] attempt. A context that already has a
+// deadline is used unchanged. Signing is local and is not bounded.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(cfg *tokenConfig) error {
+		if d <= 0 {
+			return fmt.Errorf("iamcacheauth: default timeout must be positive, got %v", d)
+		}
+		cfg.defaultTimeout = d
+		return nil
+	}
+}
+
+// retrievalContext returns the context for credential retrieval: ctx with
+// the [WithDefaultTimeout] bound if it has no deadline of its own.
+func (g *TokenGenerator) retrievalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || g.cfg.defaultTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.cfg.defaultTimeout)
+}
+
+// retrieve calls the credential provider, retrying failures as configured
+// by [WithRetry]. It returns the last error, and the number of attempts
+// made, if none succeeds.
+//
+// A done ctx fails before the provider is called: a cache, or captured
+// credentials, would otherwise serve credentials without looking at ctx,
+// and a cancelled caller would still get a token.
+func (g *TokenGenerator) retrieve(ctx context.Context) (aws.Credentials, int, error) {
+	if err := ctx.Err(); err != nil {
+		return aws.Credentials{}, 0, err
+	}
+	for attempt := 1; ; attempt++ {
+		creds, err := g.cfg.credProvider.Retrieve(ctx)
+		if err == nil || attempt >= g.cfg.retryAttempts || !g.retryWait(ctx, attempt) {
+			return creds, attempt, err
+		}
+	}
+}
+
+// retryWait waits out the backoff after the given failed attempt. It
+// reports false, without waiting, if ctx would end first.
+func (g *TokenGenerator) retryWait(ctx context.Context, attempt int) bool {
+	var wait time.Duration
+	if g.cfg.retryBackoff != nil {
+		wait = g.cfg.retryBackoff(attempt)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+		return false
+	}
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
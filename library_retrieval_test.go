@@ -0,0 +1,169 @@
+package iamcacheauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestWithRetry_SucceedsAfterFailures(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		creds := &flakyCredentials{}
+		creds.fails.Store(2)
+		var backoffs []int
+		backoff := func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return time.Duration(attempt) * time.Second
+		}
+		gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds}, WithRetry(3, backoff))
+		if err != nil {
+			t.Fatalf("NewElastiCache() unexpected error: %v", err)
+		}
+
+		start := time.Now()
+		if _, err := gen.Token(context.Background()); err != nil {
+			t.Fatalf("Token() unexpected error: %v", err)
+		}
+		if got := creds.calls.Load(); got != 3 {
+			t.Errorf("Retrieve called %d times, want 3", got)
+		}
+		if len(backoffs) != 2 || backoffs[0] != 1 || backoffs[1] != 2 {
+			t.Errorf("backoff called with %v, want [1 2]", backoffs)
+		}
+		if elapsed := time.Since(start); elapsed != 3*time.Second {
+			t.Errorf("Token() took %v, want the 3s of backoff", elapsed)
+		}
+	})
+}
+
+func TestWithRetry_Exhausted(t *testing.T) {
+	creds := &flakyCredentials{}
+	creds.fails.Store(10)
+	gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds}, WithRetry(3, nil))
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+
+	_, err = gen.Token(context.Background())
+	if !errors.Is(err, ErrCredentialRetrieval) {
+		t.Fatalf("Token() error = %v, want ErrCredentialRetrieval", err)
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") || !strings.Contains(err.Error(), "flaky credentials") {
+		t.Errorf("error %q should give the attempt count and the last cause", err)
+	}
+	if got := creds.calls.Load(); got != 3 {
+		t.Errorf("Retrieve called %d times, want 3", got)
+	}
+}
+
+func TestWithRetry_StopsAtDeadline(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		creds := &flakyCredentials{}
+		creds.fails.Store(10)
+		gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds},
+			WithRetry(5, func(int) time.Duration { return 10 * time.Second }))
+		if err != nil {
+			t.Fatalf("NewElastiCache() unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, err = gen.Token(ctx)
+		if !errors.Is(err, ErrCredentialRetrieval) || !strings.Contains(err.Error(), "flaky credentials") {
+			t.Errorf("Token() error = %v, want the retrieval failure", err)
+		}
+		if got := creds.calls.Load(); got != 1 {
+			t.Errorf("Retrieve called %d times, want 1", got)
+		}
+		if elapsed := time.Since(start); elapsed != 0 {
+			t.Errorf("Token() waited %v; a backoff past the deadline should not be waited out", elapsed)
+		}
+	})
+}
+
+func TestWithRetry_DefaultIsOneAttempt(t *testing.T) {
+	creds := &flakyCredentials{}
+	creds.fails.Store(1)
+	gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds})
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	_, err = gen.Token(context.Background())
+	if !errors.Is(err, ErrCredentialRetrieval) || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("Token() error = %v, want a single-attempt retrieval failure", err)
+	}
+	if got := creds.calls.Load(); got != 1 {
+		t.Errorf("Retrieve called %d times, want 1", got)
+	}
+}
+
+func TestWithRetry_Validation(t *testing.T) {
+	if _, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"), WithRetry(0, nil)); err == nil {
+		t.Error("WithRetry(0) should return error")
+	}
+}
+
+// hangingCredentials is a test helper that blocks until release is
+// closed. Behind the credentials cache the provider never sees the caller's
+// context, so only the cache's wait on that context can end a call early.
+type hangingCredentials struct {
+	release chan struct{}
+}
+
+func (h hangingCredentials) Retrieve(context.Context) (aws.Credentials, error) {
+	<-h.release
+	return aws.Credentials{}, errors.New("released")
+}
+
+// tokenWithHangingCredentials calls Token on a generator built with opts
+// whose provider hangs, and reports how long Token took to fail.
+func tokenWithHangingCredentials(t *testing.T, ctx context.Context, opts ...Option) (time.Duration, error) {
+	t.Helper()
+	creds := hangingCredentials{release: make(chan struct{})}
+	defer close(creds.release)
+	gen, err := NewElastiCache("my-user", "my-cache", aws.Config{Region: "us-east-1", Credentials: creds}, opts...)
+	if err != nil {
+		t.Fatalf("NewElastiCache() unexpected error: %v", err)
+	}
+	start := time.Now()
+	_, err = gen.Token(ctx)
+	return time.Since(start), err
+}
+
+func TestWithDefaultTimeout_BoundsRetrieval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		elapsed, err := tokenWithHangingCredentials(t, context.Background(), WithDefaultTimeout(2*time.Second))
+		if !errors.Is(err, ErrCredentialRetrieval) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Token() error = %v, want a retrieval failure wrapping context.DeadlineExceeded", err)
+		}
+		if elapsed != 2*time.Second {
+			t.Errorf("Token() took %v, want the 2s default timeout", elapsed)
+		}
+	})
+}
+
+func TestWithDefaultTimeout_KeepsCallerDeadline(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		elapsed, err := tokenWithHangingCredentials(t, ctx, WithDefaultTimeout(2*time.Second))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Token() error = %v, want context.DeadlineExceeded", err)
+		}
+		if elapsed != time.Minute {
+			t.Errorf("Token() took %v, want the caller's 1m deadline", elapsed)
+		}
+	})
+}
+
+func TestWithDefaultTimeout_Validation(t *testing.T) {
+	if _, err := NewElastiCache("my-user", "my-cache", testAWSConfig("us-east-1"), WithDefaultTimeout(0)); err == nil {
+		t.Error("WithDefaultTimeout(0) should return error")
+	}
+}
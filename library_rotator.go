@@ -0,0 +1,88 @@
+package iamcacheauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Rotator holds a current token for a generator's user, kept fresh in the
+// background by a [Refresher], for connection pools that ask one object
+// for credentials on every reconnect. [Rotator.Credentials] returns the
+// held token without waiting on credential retrieval or signing.
+//
+// Use [NewRotator] to create instances.
+type Rotator struct {
+	gen       *TokenGenerator
+	ctx       context.Context
+	refresher *Refresher
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewRotator creates a [Rotator] for gen and starts its refresher, which
+// mints the first token straight away and then margin before each expiry,
+// as [NewRefresher] describes. ctx bounds the background refresh and any
+// synchronous mint by [Rotator.Credentials]; refreshing ends when it is
+// done or [Rotator.Stop] is called.
+func NewRotator(ctx context.Context, gen *TokenGenerator, margin time.Duration) (*Rotator, error) {
+	r, err := NewRefresher(gen, margin)
+	if err != nil {
+		return nil, err
+	}
+	rot := &Rotator{gen: gen, ctx: ctx, refresher: r}
+	r.observe = rot.store
+	r.Start(ctx)
+	return rot, nil
+}
+
+// Credentials returns the generator's user and the held token, for
+// passing to a client's AUTH. While the refresher keeps up this only reads
+// the token. If no unexpired token is held yet, as before the first
+// background mint completes, a token is minted synchronously and kept.
+//
+// Credentials does not return an error, to fit pool callbacks of that
+// shape: if no token is held and the synchronous mint fails, password is
+// empty. The failure is reported to [WithOnError] and [WithLogger], if
+// set on the generator.
+func (r *Rotator) Credentials() (username, password string) {
+	r.mu.Lock()
+	token, expires := r.token, r.expires
+	r.mu.Unlock()
+	if token != "" && r.gen.cfg.clock().Before(expires) {
+		return r.gen.cfg.userID, token
+	}
+
+	token, info, err := r.gen.TokenAndInfo(r.ctx)
+	if err != nil {
+		return r.gen.cfg.userID, ""
+	}
+	r.store(token, info)
+	return r.gen.cfg.userID, token
+}
+
+// Notify forwards to [Refresher.Notify].
+func (r *Rotator) Notify() {
+	r.refresher.Notify()
+}
+
+// Stop ends background refreshing, as [Refresher.Stop] does. Credentials
+// keeps returning the held token until it expires, and mints
+// synchronously after that.
+func (r *Rotator) Stop() {
+	r.refresher.Stop()
+}
+
+// store keeps token unless the one held expires later. Tokens are ordered
+// by expiry rather than compared, since a synchronous mint and a
+// background one can race and either may finish first.
+func (r *Rotator) store(token string, info TokenInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.Expires.Before(r.expires) {
+		return
+	}
+	r.token, r.expires = token, info.Expires
+}
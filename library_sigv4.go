@@ -0,0 +1,292 @@
+package iamcacheauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens are presigned by assembling the SigV4 canonical request directly
+// from the signing inputs rather than building an *http.Request for a
+// general-purpose signer and formatting its URL. The output is byte for
+// byte what the smithy-go signer produces for the same request, except
+// that spaces in the query are written as %20, as the AWS SDK signer
+// writes them, rather than "+"; the differential tests hold it to both.
+
+const (
+	sigv4Algorithm = "AWS4-HMAC-SHA256"
+
+	// sigv4TimeFormat is the X-Amz-Date format; sigv4DateFormat is the
+	// date used in the credential scope.
+	sigv4TimeFormat = "20060102T150405Z"
+	sigv4DateFormat = "20060102"
+
+	// sigv4SignedHeaders lists the headers signed into a token.
+	sigv4SignedHeaders = "host"
+)
+
+// What is cached between tokens, and why it is safe:
+//
+//   - A [requestTemplate] holds what is fixed by the generator's
+//     configuration and signing host: the escaped path, the escaped Action
+//     and X-Amz-Expires values, and the canonical request around the
+//     query (method, canonical path, host header, signed headers and
+//     payload hash). It is built once and never changes.
+//   - [queryPieces] hold the escaped query apart from the two
+//     time-dependent values, X-Amz-Date and the date in X-Amz-Credential.
+//     Everything else in the query is a function of the [signingInput],
+//     which includes the credentials, so the pieces are reused only for an
+//     equal input and a credential rotation rebuilds them.
+//   - A [signer] holds the signing key, which depends only on the secret,
+//     service, region and UTC date, and a pool of HMACs keyed with it. It
+//     is replaced when any of those changes.
+//
+// What is left per token depends on the signing time: the query is joined
+// from the pieces and the two timestamps, the canonical request is hashed,
+// and the string to sign is MACed. Every cache is behind a mutex or a
+// sync.Pool, so generators stay safe for concurrent use.
+
+// queryPieces are the escaped parts of a presigned query that do not depend
+// on the signing time, in canonical key order: Action, ResourceType, User,
+// X-Amz-Algorithm, X-Amz-Credential, X-Amz-Date, X-Amz-Expires,
+// X-Amz-Security-Token, then X-Amz-SignedHeaders, which X-Amz-Signature
+// precedes in the token. The query is assembled directly in this order
+// rather than through url.Values, whose Encode sorts and escapes on every
+// call.
+type queryPieces struct {
+	head      string // Action through the access key in X-Amz-Credential
+	scopeTail string // the rest of the credential scope, up to X-Amz-Date's value
+	tail      string // X-Amz-Expires and any X-Amz-Security-Token, with a trailing "&"
+}
+
+// newQueryPieces builds the query pieces for tmpl and in. ElastiCache
+// rejects serverless tokens without ResourceType, and rejects
+// replication-group tokens that include it, so an empty in.resourceType
+// omits it.
+func newQueryPieces(tmpl *requestTemplate, in signingInput) *queryPieces {
+	var head strings.Builder
+	head.WriteString("Action=")
+	head.WriteString(tmpl.action)
+	if in.resourceType != "" {
+		head.WriteString("&ResourceType=")
+		head.WriteString(queryEscape(in.resourceType))
+	}
+	head.WriteString("&User=")
+	head.WriteString(queryEscape(in.user))
+	head.WriteString("&X-Amz-Algorithm=" + sigv4Algorithm + "&X-Amz-Credential=")
+	head.WriteString(queryEscape(in.creds.AccessKeyID))
+	head.WriteString("%2F")
+
+	tail := "&X-Amz-Expires=" + tmpl.expires
+	if in.creds.SessionToken != "" {
+		tail += "&X-Amz-Security-Token=" + queryEscape(in.creds.SessionToken)
+	}
+	return &queryPieces{
+		head:      head.String(),
+		scopeTail: "%2F" + queryEscape(in.region) + "%2F" + queryEscape(in.service) + "%2Faws4_request&X-Amz-Date=",
+		tail:      tail + "&",
+	}
+}
+
+// queryPiecesCache holds the query pieces for the most recent signing
+// input.
+type queryPiecesCache struct {
+	mu     sync.Mutex
+	in     signingInput
+	pieces *queryPieces
+}
+
+// get returns the query pieces for tmpl and in, building them if in differs
+// from the cached input. tmpl must be the template for in.host.
+func (c *queryPiecesCache) get(tmpl *requestTemplate, in signingInput) *queryPieces {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pieces == nil || c.in != in {
+		c.in, c.pieces = in, newQueryPieces(tmpl, in)
+	}
+	return c.pieces
+}
+
+// appendPresignQuery appends the canonical query for p signed at now to
+// dst, and returns it with the offset at which X-Amz-Signature is inserted
+// for the token. Only the host header is signed, as a presigned token
+// carries no other headers.
+func appendPresignQuery(dst []byte, p *queryPieces, now time.Time) (query []byte, sigAt int) {
+	dst = append(dst, p.head...)
+	dst = now.AppendFormat(dst, sigv4DateFormat)
+	dst = append(dst, p.scopeTail...)
+	dst = now.AppendFormat(dst, sigv4TimeFormat)
+	dst = append(dst, p.tail...)
+	sigAt = len(dst)
+	return append(dst, "X-Amz-SignedHeaders="+sigv4SignedHeaders...), sigAt
+}
+
+// queryEscape escapes a query key or value as [encodeQuery] does. It does
+// not allocate when s needs no escaping.
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// credentialScope returns the SigV4 credential scope for a signature made
+// at now.
+func credentialScope(now time.Time, service, region string) string {
+	return now.Format(sigv4DateFormat) + "/" + region + "/" + service + "/aws4_request"
+}
+
+// canonicalRequestPrefix and canonicalRequestSuffix return the parts of a
+// SigV4 canonical request before and after its canonical query.
+func canonicalRequestPrefix(method, canonicalPath string) string {
+	return method + "\n" + canonicalPath + "\n"
+}
+
+func canonicalRequestSuffix(host string, payloadHash []byte) string {
+	return "\nhost:" + strings.TrimSpace(host) + "\n\n" + sigv4SignedHeaders + "\n" + hex.EncodeToString(payloadHash)
+}
+
+// signingSteps holds a SigV4 signature with the intermediate values it was
+// computed from. The intermediate values are kept only on request.
+type signingSteps struct {
+	canonicalRequest string
+	stringToSign     string
+	signature        string
+}
+
+// signature computes the SigV4 signature of a presigned request with the
+// given query parameters, which must already include the X-Amz-* signing
+// parameters and must not include X-Amz-Signature.
+func signature(query url.Values, method, host, escapedPath string, payloadHash []byte,
+	secret, service, region string, now time.Time) string {
+	return sigv4Steps(newSigner(signingKey(secret, now, service, region)),
+		canonicalRequestPrefix(method, uriEncode(escapedPath)), []byte(encodeQuery(query)),
+		canonicalRequestSuffix(host, payloadHash), service, region, now, false).signature
+}
+
+// sigv4Steps computes the signature of the canonical request formed by
+// crPrefix, canonicalQuery and crSuffix with s, keeping the canonical
+// request and string to sign if keep is set. canonicalQuery is not
+// retained.
+func sigv4Steps(s *signer, crPrefix string, canonicalQuery []byte, crSuffix string,
+	service, region string, now time.Time, keep bool) signingSteps {
+	// Fixed-size buffers keep the common case on the stack; a longer
+	// request, such as one with a large session token, grows onto the heap.
+	var crBuf [2048]byte
+	cr := append(crBuf[:0], crPrefix...)
+	cr = append(cr, canonicalQuery...)
+	cr = append(cr, crSuffix...)
+	requestHash := sha256.Sum256(cr)
+
+	var stsBuf [256]byte
+	sts := append(stsBuf[:0], sigv4Algorithm+"\n"...)
+	sts = now.AppendFormat(sts, sigv4TimeFormat)
+	sts = append(sts, '\n')
+	sts = now.AppendFormat(sts, sigv4DateFormat)
+	sts = append(sts, '/')
+	sts = append(sts, region...)
+	sts = append(sts, '/')
+	sts = append(sts, service...)
+	sts = append(sts, "/aws4_request\n"...)
+	sts = hex.AppendEncode(sts, requestHash[:])
+
+	var macBuf [sha256.Size]byte
+	steps := signingSteps{signature: hex.EncodeToString(s.mac(macBuf[:0], sts))}
+	if keep {
+		steps.canonicalRequest = string(cr)
+		steps.stringToSign = string(sts)
+	}
+	return steps
+}
+
+// signingKey derives the SigV4 signing key for secret on now's date.
+func signingKey(secret string, now time.Time, service, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), now.Format(sigv4DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// signer computes HMAC-SHA256 with one signing key, reusing HMAC states
+// from a pool rather than keying a new one for each signature.
+type signer struct {
+	key  []byte
+	macs sync.Pool // of hash.Hash keyed with key
+}
+
+func newSigner(key []byte) *signer {
+	s := &signer{key: key}
+	s.macs.New = func() any { return hmac.New(sha256.New, s.key) }
+	return s
+}
+
+// mac appends the HMAC of data to dst.
+func (s *signer) mac(dst, data []byte) []byte {
+	h := s.macs.Get().(hash.Hash)
+	h.Reset()
+	h.Write(data)
+	dst = h.Sum(dst)
+	s.macs.Put(h)
+	return dst
+}
+
+// signingKeyCache holds the signer for the most recently derived signing
+// key. The key depends only on the secret, service, region and UTC date, so
+// it changes at most daily or when credentials rotate, and deriving it
+// afresh costs four HMACs per token.
+type signingKeyCache struct {
+	mu              sync.Mutex
+	secret          string
+	service, region string
+	day             int64 // Unix days; UTC dates begin on Unix day boundaries
+	signer          *signer
+}
+
+// get returns the signer for secret on now's date, deriving its key if it
+// differs from the cached one.
+func (c *signingKeyCache) get(secret string, now time.Time, service, region string) *signer {
+	day := now.Unix() / 86400
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.signer == nil || c.secret != secret || c.service != service || c.region != region || c.day != day {
+		c.signer = newSigner(signingKey(secret, now, service, region))
+		c.secret, c.service, c.region, c.day = secret, service, region, day
+	}
+	return c.signer
+}
+
+// encodeQuery returns the SigV4 canonical form of query, which is also the
+// form written into tokens. Every parameter has a single value, so Encode's
+// ordering by key is already canonical. SigV4 requires spaces as %20, not
+// "+"; a literal "+" is encoded as %2B, so only spaces are affected.
+func encodeQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes every byte except unreserved characters and "/", as
+// SigV4 requires for the canonical path.
+func uriEncode(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0xF])
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package iamcacheauth
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// TLSConfig returns a TLS configuration for connecting to an ElastiCache or
+// MemoryDB endpoint, which IAM authentication requires. It verifies the
+// server certificate against serverName, with any port removed, and
+// requires TLS 1.2 or later, the oldest version both services accept.
+//
+// serverName should be the endpoint host the client dials, not the cache
+// or cluster name signed into the token. A new value is returned on every
+// call, so callers may adjust it.
+func TLSConfig(serverName string) *tls.Config {
+	if host, _, err := net.SplitHostPort(serverName); err == nil {
+		serverName = host
+	}
+	return &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+}
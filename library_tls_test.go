@@ -0,0 +1,33 @@
+package iamcacheauth
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "master.my-cache.abc123.use1.cache.amazonaws.com", want: "master.my-cache.abc123.use1.cache.amazonaws.com"},
+		{serverName: "clustercfg.my-cluster.abc123.memorydb.us-east-1.amazonaws.com:6379", want: "clustercfg.my-cluster.abc123.memorydb.us-east-1.amazonaws.com"},
+		{serverName: "[fd00::1]:6379", want: "fd00::1"},
+	}
+	for _, tt := range tests {
+		cfg := TLSConfig(tt.serverName)
+		if cfg.ServerName != tt.want {
+			t.Errorf("TLSConfig(%q).ServerName = %q, want %q", tt.serverName, cfg.ServerName, tt.want)
+		}
+		if cfg.MinVersion != tls.VersionTLS12 {
+			t.Errorf("TLSConfig(%q).MinVersion = %x, want TLS 1.2", tt.serverName, cfg.MinVersion)
+		}
+		if cfg.InsecureSkipVerify {
+			t.Errorf("TLSConfig(%q) must verify the server certificate", tt.serverName)
+		}
+	}
+
+	if TLSConfig("a") == TLSConfig("a") {
+		t.Error("TLSConfig() should return a new value on every call")
+	}
+}
@@ -0,0 +1,78 @@
+package iamcacheauth
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrSignatureMismatch is returned, wrapped with detail, by
+// [VerifySignature] when a token would not be accepted with the given
+// credentials, service, region and time.
+var ErrSignatureMismatch = errors.New("iamcacheauth: signature mismatch")
+
+// VerifySignature recomputes the SigV4 signature of token and compares it
+// with X-Amz-Signature, so tests can check that a token would be accepted
+// without calling AWS. It also checks that the credential scope names
+// creds, service and region and that the token is valid at now.
+//
+// Tokens are verified as GET requests with an empty payload, the defaults;
+// a token signed with [WithHTTPMethod] or [WithPayloadHash] does not
+// verify. A structurally invalid token returns [ErrMalformedToken]; any
+// other failure returns [ErrSignatureMismatch].
+func VerifySignature(token string, creds aws.Credentials, service, region string, now time.Time) error {
+	res, err := ParseToken(token)
+	if err != nil {
+		return err
+	}
+	prefix, rawQuery, _ := strings.Cut(token, "?")
+	escapedPath := strings.TrimPrefix(prefix, res.Host)
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedToken, err)
+	}
+	for key, values := range query {
+		if len(values) != 1 {
+			return fmt.Errorf("%w: %s appears %d times", ErrMalformedToken, key, len(values))
+		}
+	}
+
+	want := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	if got := query.Get("X-Amz-Algorithm"); got != sigv4Algorithm {
+		return fmt.Errorf("%w: algorithm %q, want %q", ErrSignatureMismatch, got, sigv4Algorithm)
+	}
+	if got, scope := query.Get("X-Amz-Credential"), creds.AccessKeyID+"/"+credentialScope(res.SignedAt, service, region); got != scope {
+		return fmt.Errorf("%w: credential %q, want %q", ErrSignatureMismatch, got, scope)
+	}
+	if got := query.Get("X-Amz-SignedHeaders"); got != sigv4SignedHeaders {
+		return fmt.Errorf("%w: signed headers %q, want %q", ErrSignatureMismatch, got, sigv4SignedHeaders)
+	}
+	if query.Has("X-Amz-Security-Token") && query.Get("X-Amz-Security-Token") != creds.SessionToken {
+		return fmt.Errorf("%w: security token differs from the credentials' session token", ErrSignatureMismatch)
+	}
+	if now.Before(res.SignedAt) {
+		return fmt.Errorf("%w: signed at %s, after %s", ErrSignatureMismatch,
+			res.SignedAt.Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	}
+	if expires := res.SignedAt.Add(res.ExpiresIn); !now.Before(expires) {
+		return fmt.Errorf("%w: expired at %s", ErrSignatureMismatch, expires.Format(time.RFC3339))
+	}
+
+	got := signature(query, http.MethodGet, res.Host, escapedPath, emptyPayloadHash[:],
+		creds.SecretAccessKey, service, region, res.SignedAt)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return fmt.Errorf("%w: X-Amz-Signature does not match the recomputed signature", ErrSignatureMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Package redigoauth supplies IAM credentials to redigo connections.
+//
+// redigo has no per-connection credential callback, so a token is minted
+// when the dial options are built. It is a separate package so that redigo
+// is only linked into programs that use it.
+package redigoauth
+
+import (
+	"context"
+
+	"github.com/chinmina/iamcacheauth"
+	"github.com/gomodule/redigo/redis"
+)
+
+// DialOptions mints a token from gen and returns the username, password and
+// TLS options for redis.Dial. An empty username means the user ID gen signs
+// for.
+//
+// The token is valid only briefly and must not be reused: call DialOptions
+// afresh for every dial, for example inside a redis.Pool's Dial function,
+// rather than building the options once.
+func DialOptions(ctx context.Context, gen *iamcacheauth.TokenGenerator, username string) ([]redis.DialOption, error) {
+	user, token, err := gen.ConnectCredentialsFunc()(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		username = user
+	}
+	return []redis.DialOption{
+		redis.DialUsername(username),
+		redis.DialPassword(token),
+		redis.DialUseTLS(true),
+	}, nil
+}